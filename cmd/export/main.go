@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/export"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/store"
+	"golang.org/x/exp/slog"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// export flattens stored results into a table with one row per trial (see export.Columns), in CSV or Parquet.
+func main() {
+
+	logLevel := flag.String("log-level", "info", "Log level")
+	storeURI := flag.String("store", "static/results.jsonl", "Results to export: a postgres:// URL, the path of a JSON-lines results store, or a .json file of results such as static/data.json")
+	format := flag.String("format", "", fmt.Sprintf("Output format, one of %v (defaults to the extension of -out, or csv)", export.Formats))
+	out := flag.String("out", "", "File to write the table to (stdout if empty)")
+	filterSpec := flag.String("filter", "", "Only export the results whose parameters match, e.g. C=100..1000,X=..0.2,Adversary=adaptive")
+	flag.Parse()
+
+	pl.SetUpLogrusAndSlog(*logLevel)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*out), ".")
+		if *format == "" {
+			*format = "csv"
+		}
+	}
+	filter, err := export.ParseFilter(*filterSpec)
+	if err != nil {
+		slog.Error("Invalid -filter.", err)
+		os.Exit(1)
+	}
+
+	results, err := loadResults(context.Background(), *storeURI)
+	if err != nil {
+		slog.Error("Failed to load results.", err)
+		os.Exit(1)
+	}
+	rows := export.Rows(results, filter)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			slog.Error("Failed to create output file.", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err = export.Write(w, *format, rows); err != nil {
+		slog.Error("Export failed.", err)
+		os.Exit(1)
+	}
+	if *out != "" {
+		// logs go to stdout, so they would corrupt a table written there
+		slog.Info("Exported", "File", *out, "Rows", len(rows), "Format", *format)
+	}
+}
+
+// loadResults reads every result from the store at uri, or from the results file at uri if it is a .json file.
+func loadResults(ctx context.Context, uri string) (map[string]data.Result, error) {
+	if strings.HasSuffix(uri, ".json") {
+		return data.ReadResults(uri)
+	}
+	if !strings.Contains(uri, "://") {
+		// don't let the file store create an empty store
+		if _, err := os.Stat(uri); err != nil {
+			return nil, pl.WrapError(err, "no results store at %s", uri)
+		}
+	}
+	s, err := store.Open(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return s.Load(ctx)
+}
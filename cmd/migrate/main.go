@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"golang.org/x/exp/slog"
+	"io/ioutil"
+	"os"
+)
+
+// migrate upgrades files of results written by earlier versions of the UI (static/data.json and static/olddata.json by
+// default) to the current format: every result is upgraded to data.SchemaVersion and keyed by Parameters.Key.
+func main() {
+
+	logLevel := flag.String("log-level", "info", "Log level")
+	backup := flag.Bool("backup", true, "Keep a copy of every migrated file as <file>.bak")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [files...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	pl.SetUpLogrusAndSlog(*logLevel)
+
+	files := flag.Args()
+	if len(files) == 0 {
+		for _, path := range []string{"static/data.json", "static/olddata.json"} {
+			if _, err := os.Stat(path); err == nil {
+				files = append(files, path)
+			}
+		}
+	}
+	if len(files) == 0 {
+		slog.Info("Nothing to migrate")
+		return
+	}
+
+	for _, path := range files {
+		if err := migrate(path, *backup); err != nil {
+			slog.Error("Migration failed.", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func migrate(path string, backup bool) error {
+	results, err := data.ReadResults(path)
+	if err != nil {
+		return err
+	}
+
+	if backup {
+		fileContent, err := ioutil.ReadFile(path)
+		if err != nil {
+			return pl.WrapError(err, "failed to read %s", path)
+		}
+		if _, err = os.Stat(path + ".bak"); !errors.Is(err, os.ErrNotExist) {
+			return pl.NewError("backup %s.bak already exists", path)
+		}
+		if err = ioutil.WriteFile(path+".bak", fileContent, 0644); err != nil {
+			return pl.WrapError(err, "failed to back up %s", path)
+		}
+	}
+
+	if err = data.WriteResults(path, results); err != nil {
+		return err
+	}
+
+	numTrials := 0
+	for _, v := range results {
+		numTrials += len(v.Ratios)
+	}
+	slog.Info("Migrated", "File", path, "Version", data.SchemaVersion, "Params", len(results), "Trials", numTrials)
+	return nil
+}
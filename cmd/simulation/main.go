@@ -4,9 +4,17 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	pl "github.com/HannahMarsh/PrettyLogger"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/privacy"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation/rounds"
 	"golang.org/x/exp/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -16,7 +24,24 @@ func main() {
 	X := flag.Float64("X", 0.0, "Fraction of corrupted relays")
 	serverLoad := flag.Float64("serverLoad", 100000.0, "Server load, i.e. the expected number of onions processed per relay per relay")
 	L := flag.Int("L", 1, "Number of rounds")
+	T := flag.Int("t", 0, "Checkpoint threshold: relays stop forwarding once more than this many checkpoint onions are missing (0 disables)")
+	bruiseThreshold := flag.Int("bruiseThreshold", 0, "Honest relays discard onions with this many bruises (0 disables bruising)")
+	adversary := flag.String("adversary", "default", fmt.Sprintf("Adversary strategy, one of %v", rounds.AdversaryNames()))
+	epochs := flag.Int("epochs", 1, "Number of epochs in which the clients send to the same receivers, with the adversary intersecting its observations (see -composeEpochs for independent epochs)")
+	pattern := flag.String("pattern", "permutation", fmt.Sprintf("Traffic pattern of the clients' messages, one of %v, optionally followed by :<arg> (e.g. zipf:1.5)", rounds.TrafficPatternNames()))
+	XClients := flag.Float64("XClients", 0.0, "Fraction of corrupted clients (never C_1 or C_2)")
+	corruptedClients := flag.String("corruptedClients", "", "Comma-separated ids of clients that are always corrupted, e.g. 19,20 to corrupt both possible receivers")
+	topology := flag.String("topology", "free", fmt.Sprintf("Relay topology, one of %v, optionally followed by :<arg> (e.g. cascade:2)", rounds.TopologyNames()))
+	relayWeights := flag.String("relayWeights", "", "Weights (e.g. bandwidth) of the relays in path selection: a YAML, JSON or TOML config file, or a comma-separated list in relay order (empty is uniform)")
 	numRuns := flag.Int("numRuns", 1, "Number of runs")
+	workers := flag.Int("workers", runtime.NumCPU(), "Number of trials to run in parallel")
+	exact := flag.Bool("exact", false, "Enumerate every execution and output the exact ratio distribution instead of sampling (toy parameters only)")
+	maxExecutions := flag.Int("maxExecutions", 1000000, "With -exact, the maximum number of executions to enumerate per scenario")
+	delta := flag.Float64("delta", 0.0, "The δ for which ϵ is reported: the exact ϵ with -exact, otherwise the smallest ϵ that holds with the given -confidence (0 reports nothing without -exact)")
+	confidence := flag.Float64("confidence", 0.95, "Confidence with which the reported ϵ must hold (pointwise: the bounds on δ hold with this confidence at any one ϵ, not simultaneously at every ϵ)")
+	composeEpochs := flag.Int("composeEpochs", 1, "With -delta, also report the ϵ after this many independent epochs, composed with the privacy loss distribution (unlike -epochs, which simulates them)")
+	seed := flag.Int64("seed", 0, "Base RNG seed; trial i uses seed+i (0 picks a seed from the clock)")
+	output := flag.String("output", "json", "Output format: json prints the whole Result once every trial is done, jsonl prints every trial on its own line as soon as it is done")
 
 	flag.Parse()
 
@@ -26,14 +51,86 @@ func main() {
 	//	return
 	//}
 
+	if *output != "json" && *output != "jsonl" {
+		slog.Error("Invalid -output.", pl.NewError("unknown output format %q (expected json or jsonl)", *output))
+		os.Exit(1)
+	}
+	if *composeEpochs < 1 {
+		slog.Error("Invalid -composeEpochs.", pl.NewError("the number of composed epochs must be at least 1, got %d", *composeEpochs))
+		os.Exit(1)
+	}
+	if *exact && *output == "jsonl" {
+		slog.Error("Invalid -output.", pl.NewError("-exact only supports -output json"))
+		os.Exit(1)
+	}
+
+	clientIds, err := parseList(*corruptedClients, strconv.Atoi)
+	if err != nil {
+		slog.Error("Invalid -corruptedClients.", err)
+		os.Exit(1)
+	}
+	weights, err := loadRelayWeights(*relayWeights, *R)
+	if err != nil {
+		slog.Error("Invalid -relayWeights.", err)
+		os.Exit(1)
+	}
+
 	p := data.Parameters{
-		C:          *C,
-		R:          *R,
-		X:          *X,
-		ServerLoad: *serverLoad,
-		L:          *L,
+		C:                *C,
+		R:                *R,
+		X:                *X,
+		ServerLoad:       *serverLoad,
+		L:                *L,
+		T:                *T,
+		BruiseThreshold:  *bruiseThreshold,
+		Adversary:        *adversary,
+		Epochs:           *epochs,
+		Pattern:          *pattern,
+		XClients:         *XClients,
+		CorruptedClients: clientIds,
+		Topology:         *topology,
+		RelayWeights:     weights,
+	}
+	if *exact {
+		runExact(p, *maxExecutions, *delta)
+		return
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	var onTrial func(data.Trial) error
+	if *output == "jsonl" {
+		// stdout is unbuffered, so every line can be read as soon as its trial is done
+		encoder := json.NewEncoder(os.Stdout)
+		onTrial = func(t data.Trial) error {
+			return encoder.Encode(t)
+		}
+	}
+
+	v, err := simulation.RunStreaming(p, *numRuns, *seed, *workers, onTrial)
+	if err != nil {
+		slog.Error("Simulation failed.", err)
+		os.Exit(1)
+	}
+
+	if *delta > 0 {
+		epsilon := privacy.NewEstimator(*v, *confidence).Epsilon(*delta)
+		slog.Info("Estimated privacy", "delta", *delta, "confidence", *confidence, "epsilon", fmt.Sprintf("%f", epsilon))
+
+		accountant := privacy.NewAccountant(*v, privacy.DefaultStep).Epochs(*composeEpochs)
+		slog.Info("Composed privacy", "delta", *delta, "composeEpochs", *composeEpochs, "epsilon", fmt.Sprintf("%f", accountant.Epsilon(*delta)))
+
+		for epoch := 1; epoch < p.Epochs; epoch++ {
+			epsilon := privacy.NewEstimator(v.AfterEpoch(epoch), *confidence).Epsilon(*delta)
+			slog.Info("Estimated privacy", "epoch", epoch, "delta", *delta, "confidence", *confidence, "epsilon", fmt.Sprintf("%f", epsilon))
+		}
+	}
+
+	if *output == "jsonl" {
+		return
 	}
-	v := simulation.Run(p, *numRuns)
 
 	str, err := json.Marshal(v)
 	if err != nil {
@@ -42,3 +139,47 @@ func main() {
 		fmt.Println(string(str))
 	}
 }
+
+func runExact(p data.Parameters, maxExecutions int, delta float64) {
+	v, err := simulation.RunExact(p, maxExecutions)
+	if err != nil {
+		slog.Error("Exact computation failed.", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Exact privacy", "delta", delta, "epsilon", fmt.Sprintf("%f", v.Epsilon(delta)), "executions", v.NumExecutions)
+
+	str, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Couldn't marshall ExactResult.", err)
+	} else {
+		fmt.Println(string(str))
+	}
+}
+
+// parseList parses a comma-separated list ("" is the empty list).
+func parseList[T any](list string, parse func(string) (T, error)) ([]T, error) {
+	if list == "" {
+		return nil, nil
+	}
+	values := make([]T, 0)
+	for _, field := range strings.Split(list, ",") {
+		value, err := parse(strings.TrimSpace(field))
+		if err != nil {
+			return nil, pl.WrapError(err, "invalid value %q", field)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// loadRelayWeights returns the relay weights given by -relayWeights: either a config file (see
+// data.RelayWeightsConfig) or a comma-separated list of weights.
+func loadRelayWeights(value string, R int) ([]float64, error) {
+	if _, err := os.Stat(value); value != "" && err == nil {
+		return data.LoadRelayWeights(value, R)
+	}
+	return parseList(value, func(field string) (float64, error) {
+		return strconv.ParseFloat(field, 64)
+	})
+}
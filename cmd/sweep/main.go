@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/runner"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/store"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/sweep"
+	"go.uber.org/automaxprocs/maxprocs"
+	"golang.org/x/exp/slog"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// sweep runs the parameter sweep described by a sweep spec (see sweep.Spec) without the web server. Trials are added
+// to the results store, and progress is tracked in a manifest, so an interrupted sweep resumes where it stopped.
+func main() {
+
+	logLevel := flag.String("log-level", "info", "Log level")
+	specFile := flag.String("spec", "static/sweep.yaml", "YAML, JSON or TOML file describing the sweep")
+	storeURI := flag.String("store", "static/results.jsonl", "Where to persist results: a postgres:// URL or the path of a JSON-lines file")
+	manifestFile := flag.String("manifest", "", "File that tracks the progress of the sweep across restarts (defaults to the spec file with the extension .progress.json)")
+	jobs := flag.Int("jobs", runtime.NumCPU(), "Number of trials to run at a time")
+	isolated := flag.Bool("isolated", false, "Run every trial in its own process instead of in-process")
+	simulationCmd := flag.String("simulation-cmd", "go run cmd/simulation/main.go", "With -isolated, the command that runs cmd/simulation")
+	dryRun := flag.Bool("dry-run", false, "Print the points of the sweep and exit")
+	flag.Parse()
+
+	pl.SetUpLogrusAndSlog(*logLevel)
+
+	if _, err := maxprocs.Set(); err != nil {
+		slog.Error("failed set max procs", err)
+		os.Exit(1)
+	}
+
+	spec, err := sweep.LoadSpec(*specFile)
+	if err != nil {
+		slog.Error("failed to load sweep spec", err)
+		os.Exit(1)
+	}
+	points, err := spec.Points()
+	if err != nil {
+		slog.Error("invalid sweep spec", err)
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		for _, point := range points {
+			fmt.Printf("%s\t%d\n", point.P.Key(), point.Target)
+		}
+		return
+	}
+
+	var jobRunner runner.Runner = &runner.InProcess{Workers: 1}
+	if *isolated {
+		jobRunner = &runner.Subprocess{Command: strings.Fields(*simulationCmd)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		slog.Info("Stopping sweep; waiting for the running trials", "Signal", sig)
+		cancel()
+	}()
+
+	resultStore, err := store.Open(ctx, *storeURI)
+	if err != nil {
+		slog.Error("failed to open results store", err)
+		os.Exit(1)
+	}
+	defer resultStore.Close()
+
+	results, err := resultStore.Load(ctx)
+	if err != nil {
+		slog.Error("failed to load results", err)
+		os.Exit(1)
+	}
+
+	if *manifestFile == "" {
+		*manifestFile = strings.TrimSuffix(*specFile, filepath.Ext(*specFile)) + ".progress.json"
+	}
+	manifest, err := sweep.LoadManifest(*manifestFile)
+	if err != nil {
+		slog.Error("failed to load sweep manifest", err)
+		os.Exit(1)
+	}
+	for _, point := range points {
+		v := results[point.P.Key()]
+		if err = manifest.Add(point.P, point.Target, len(v.Ratios)); err != nil {
+			slog.Error("failed to add parameters to sweep", err)
+			os.Exit(1)
+		}
+	}
+
+	if err = manifest.SetPrecision(spec.Precision); err != nil {
+		slog.Error("failed to set the precision of the sweep", err)
+		os.Exit(1)
+	}
+	for _, point := range points {
+		if v, present := results[point.P.Key()]; present {
+			if err = manifest.Measure(v); err != nil {
+				slog.Error("failed to measure the precision of a point", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	progress := manifest.Progress()
+	slog.Info("Starting sweep", "Points", len(points), "Completed", progress.Completed, "Target", progress.Target, "Precise", progress.Precise)
+
+	// results holds every trial of the sweep's points, so that the confidence interval of a point can be measured
+	// after each trial
+	var resultsMu sync.Mutex
+
+	var wg sync.WaitGroup
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				p, ok := manifest.Next(ctx)
+				if !ok {
+					return
+				}
+				v, err := jobRunner.Run(ctx, p, 1, rand.Int63())
+				if err == nil {
+					err = resultStore.Append(ctx, *v)
+				}
+				if err == nil {
+					resultsMu.Lock()
+					r := results[p.Key()]
+					r.AppendTrials(*v)
+					results[p.Key()] = r
+					measured := r.Head(len(r.Ratios)) // unchanged by the trials appended while it is measured
+					resultsMu.Unlock()
+					err = manifest.Measure(measured)
+				}
+				if err != nil {
+					slog.Error("failed to run trial", pl.WrapError(err, "failed to run trial of %s", p.Hash()))
+				}
+				if err = manifest.Done(p, err); err != nil {
+					slog.Error("failed to update sweep manifest", err)
+				}
+				progress := manifest.Progress()
+				slog.Info("Sweep progress", "Completed", progress.Completed, "Target", progress.Target, "Precise", progress.Precise, "Failures", progress.Failures, "ETA", progress.ETA.Round(time.Second))
+			}
+		}()
+	}
+	wg.Wait()
+	if err = manifest.Flush(); err != nil {
+		slog.Error("failed to save sweep manifest", err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		slog.Info("Sweep stopped", "Completed", manifest.Progress().Completed)
+		return
+	}
+	slog.Info("Sweep done", "Completed", manifest.Progress().Completed, "Precise", manifest.Progress().Precise, "Failures", manifest.Progress().Failures)
+}
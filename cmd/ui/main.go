@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,20 +10,29 @@ import (
 	pl "github.com/HannahMarsh/PrettyLogger"
 	data2 "github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/display"
-	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/export"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/privacy"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/runner"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/store"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/sweep"
 	"go.uber.org/automaxprocs/maxprocs"
 	"golang.org/x/exp/slog"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
-var dataFile = "static/data.json"
+// legacyDataFile is where results were kept before the results store; it is imported into an empty store on startup.
+var legacyDataFile = "static/data.json"
 
 var expectedValues ExpectedValues
 
@@ -43,6 +52,14 @@ func main() {
 	// Define command-line flags
 	logLevel := flag.String("log-level", "debug", "Log level")
 	port := flag.Int("port", 8200, "Port to serve on")
+	isolated := flag.Bool("isolated", false, "Run every simulation job in its own process instead of in-process")
+	simulationCmd := flag.String("simulation-cmd", "go run cmd/simulation/main.go", "With -isolated, the command that runs cmd/simulation")
+	workers := flag.Int("workers", runtime.NumCPU(), "Number of trials of an in-process job to run in parallel")
+	manifestFile := flag.String("manifest", "static/sweep.json", "File that tracks the progress of the parameter sweep across restarts")
+	storeURI := flag.String("store", "static/results.jsonl", "Where to persist results: a postgres:// URL or the path of a JSON-lines file")
+	runs := flag.Int("runs", 100, "Number of trials per point of the parameter sweep (with -precision-width, the most trials per point)")
+	precisionWidth := flag.Float64("precision-width", 0, "Keep adding trials to a point of the sweep until the confidence interval on its measure is at most this wide (0 runs -runs trials at every point)")
+	precisionMeasure := flag.String("precision-measure", "epsilon", fmt.Sprintf("With -precision-width, the estimate whose confidence interval is bounded (one of %v)", sweep.Measures))
 	flag.Usage = flag.PrintDefaults
 	flag.Parse()
 
@@ -54,6 +71,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *isolated {
+		jobRunner = &runner.Subprocess{Command: strings.Fields(*simulationCmd)}
+	} else {
+		jobRunner = &runner.InProcess{Workers: *workers}
+	}
+
 	// Read the existing JSON file
 	filePath := "static/expectedValues.json"
 	fileContent, err := ioutil.ReadFile(filePath)
@@ -67,17 +90,36 @@ func main() {
 		fmt.Printf("Error unmarshaling JSON: %v\n", err)
 	}
 
-	// Read the existing JSON file
-	filePath = dataFile
-	fileContent, err = ioutil.ReadFile(filePath)
+	resultStore, err = store.Open(context.Background(), *storeURI)
 	if err != nil {
-		fmt.Printf("Error reading file: %v\n", err)
-		return
+		slog.Error("failed to open results store", err)
+		os.Exit(1)
 	}
 
-	// Unmarshal the JSON content into a struct
-	if err := json.Unmarshal(fileContent, &cache); err != nil {
-		fmt.Printf("Error unmarshaling JSON: %v\n", err)
+	if cache, err = resultStore.Load(context.Background()); err != nil {
+		slog.Error("failed to load results", err)
+		os.Exit(1)
+	}
+
+	if len(cache) == 0 {
+		if err = importLegacyData(context.Background(), legacyDataFile); err != nil {
+			slog.Error("failed to import legacy data", err)
+			os.Exit(1)
+		}
+	}
+
+	if manifest, err = sweep.LoadManifest(*manifestFile); err != nil {
+		slog.Error("failed to load sweep manifest", err)
+		os.Exit(1)
+	}
+
+	var precision *sweep.Precision
+	if *precisionWidth > 0 {
+		precision = &sweep.Precision{Measure: *precisionMeasure, Width: *precisionWidth}
+	}
+	if err = manifest.SetPrecision(precision); err != nil {
+		slog.Error("failed to set the precision of the sweep", err)
+		os.Exit(1)
 	}
 
 	// Start HTTP server
@@ -90,7 +132,12 @@ func main() {
 	http.Handle("/", withHeaders(http.FileServer(http.Dir("static"))))
 	http.Handle("/plots/", withHeaders(http.StripPrefix("/plots/", http.FileServer(http.Dir("static/plots")))))
 	http.Handle("/query", withHeaders(http.HandlerFunc(queryHandler)))
+	http.Handle("/privacy", withHeaders(http.HandlerFunc(privacyHandler)))
 	http.Handle("/expected", withHeaders(http.HandlerFunc(handleExpectedValues)))
+	http.Handle("/export", withHeaders(http.HandlerFunc(handleExport)))
+	http.Handle("/sweep", withHeaders(http.HandlerFunc(handleSweep)))
+	http.Handle("/sweep/pause", withHeaders(http.HandlerFunc(handlePauseSweep)))
+	http.Handle("/sweep/resume", withHeaders(http.HandlerFunc(handleResumeSweep)))
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -103,7 +150,6 @@ func main() {
 	go func() {
 		sig := <-sigChan
 		fmt.Printf("Received signal: %s\n", sig)
-		packageData()
 		// Create a context with a timeout to gracefully shut down the server
 
 		defer cancel()
@@ -114,10 +160,13 @@ func main() {
 		} else {
 			fmt.Println("Server gracefully stopped")
 		}
+		if err := resultStore.Close(); err != nil {
+			slog.Error("failed to close results store", err)
+		}
 		os.Exit(0)
 	}()
 
-	go collectData(expectedValues, ctx)
+	go collectData(expectedValues, *runs, ctx)
 
 	slog.Info(fmt.Sprintf("Starting server on http://localhost:%d", *port))
 	if err = server.ListenAndServe(); err != nil {
@@ -127,6 +176,12 @@ func main() {
 	}
 }
 
+var jobRunner runner.Runner
+
+var resultStore store.ResultStore
+
+var manifest *sweep.Manifest
+
 var cache = make(map[string]data2.Result)
 var mu sync.RWMutex
 
@@ -136,158 +191,62 @@ func getOrCalcData(p data2.Parameters, numRuns int) (v data2.Result) {
 		//v = calcData(p, numRuns)
 		return v
 	}
-	if len(v.Ratios) > numRuns {
-		return data2.Result{
-			P:      p,
-			Pr0:    v.Pr0[:numRuns],
-			Pr1:    v.Pr1[:numRuns],
-			Ratios: v.Ratios[:numRuns],
-		}
-	}
-	return v
+	return v.Head(numRuns)
 }
 
-func calcData(p data2.Parameters, numRuns int) (v data2.Result) {
-
-	// Convert parameters to strings
-	CStr := strconv.Itoa(p.C)
-	RStr := strconv.Itoa(p.R)
-	serverLoadStr := strconv.FormatFloat(p.ServerLoad, 'f', 1, 64)
-	XStr := strconv.FormatFloat(p.X, 'f', 1, 64)
-	LStr := strconv.Itoa(p.L)
-	numRunsStr := strconv.Itoa(numRuns)
-
-	cmd := exec.Command("go", "run", "cmd/simulation/main.go",
-		"-C", CStr,
-		"-R", RStr,
-		"-serverLoad", serverLoadStr,
-		"-X", XStr,
-		"-L", LStr,
-		"-numRuns", numRunsStr,
-	)
-
-	// Debug: Print command
-	//fmt.Printf("Executing: go run cmd/simulation/main.go -C %s -R %s -serverLoad %s -X %s -L %s -numRuns %s\n", CStr, RStr, serverLoadStr, XStr, LStr, numRunsStr)
-
-	// Set up pipes for stdout and stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		slog.Error("failed to get stdout pipe", err)
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		slog.Error("failed to get stderr pipe", err)
-	}
-
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		slog.Error("failed to start command", err)
-	}
-
-	var outputBuf, errorBuf []byte
-	done := make(chan error)
-
-	// Read stdout in a separate goroutine
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			outputBuf = append(outputBuf, line...)
-			//slog.Info("stdout", "line", line)
-		}
-		if err := scanner.Err(); err != nil {
-			slog.Error("error reading stdout", err)
-		}
-	}()
-
-	// Read stderr in a separate goroutine
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			errorBuf = append(errorBuf, line...)
-			pl.LogNewError(line)
-		}
-		if err := scanner.Err(); err != nil {
-			slog.Error("error reading stderr", err)
-		}
-	}()
-
-	// Wait for the command to finish
-	go func() {
-		done <- cmd.Wait()
-	}()
-
-	err = <-done
+// calcData runs numRuns more trials of p with the job runner and adds them to the store and the cache.
+func calcData(ctx context.Context, p data2.Parameters, numRuns int) (data2.Result, error) {
+	v, err := jobRunner.Run(ctx, p, numRuns, rand.Int63())
 	if err != nil {
-		slog.Error("Command execution failed", err)
-		return v
-	} else {
-		slog.Info(fmt.Sprintf("Done with go run cmd/simulation/main.go -C %s -R %s -serverLoad %s -X %s -L %s -numRuns %s", CStr, RStr, serverLoadStr, XStr, LStr, numRunsStr))
+		return data2.Result{}, pl.WrapError(err, "failed to calculate data for %s", p.Hash())
 	}
-
-	err = json.Unmarshal(outputBuf, &v)
-	if err != nil {
-		slog.Error("Failed to unmarshall", err)
-	}
-
-	return setData(p, v)
+	slog.Info("Done with", "Params", p.Hash(), "NumRuns", numRuns)
+	return setData(ctx, p, *v)
 }
 
 func getData(p data2.Parameters) (v data2.Result, present bool) {
 	mu.RLock()
 	defer mu.RUnlock()
 	var d data2.Result
-	if d, present = cache[p.Hash()]; present {
-		return d, true
+	if d, present = cache[p.Key()]; present {
+		return d.Head(len(d.Ratios)), true
 	}
 	return v, false
 }
 
-func setData(p data2.Parameters, v data2.Result) data2.Result {
+// setData persists the trials of v before adding them to the cache, so that the cache never holds a trial that would
+// be lost on a crash. Storage is slow, so it happens before taking the lock; trials that complete at the same time may
+// then be cached in a different order from the one they were stored in.
+func setData(ctx context.Context, p data2.Parameters, v data2.Result) (data2.Result, error) {
+	if err := resultStore.Append(ctx, v); err != nil {
+		return data2.Result{}, pl.WrapError(err, "failed to store data for %s", p.Hash())
+	}
 	mu.Lock()
 	defer mu.Unlock()
-	if d, present := cache[p.Hash()]; present && d.Ratios != nil && len(d.Ratios) > 0 {
-		r := data2.Result{
-			P:      p,
-			Pr0:    append(d.Pr0, v.Pr0...),
-			Pr1:    append(d.Pr1, v.Pr1...),
-			Ratios: append(d.Ratios, v.Ratios...),
-		}
-		cache[p.Hash()] = r
-		return r
-	} else {
-		cache[p.Hash()] = v
-		return v
-	}
+	d := cache[p.Key()]
+	d.AppendTrials(v)
+	cache[p.Key()] = d
+	return d.Head(len(d.Ratios)), nil
 }
 
-func collectData(values ExpectedValues, ctx context.Context) {
+// concurrentJobs is the number of simulation jobs collectData runs at a time.
+const concurrentJobs = 3
+
+// collectData sweeps the given parameter values with runs trials per point (or, with a precision set on the manifest,
+// at most runs trials per point).
+func collectData(values ExpectedValues, runs int, ctx context.Context) {
 	nValues := values.N
 	rValues := values.R
 	serverLoadValues := values.ServerLoad
 	lValues := values.L
 	xValues := values.X
 
-	numRunsPerCall := 1
-
-	index := 0
-
-	ps := make([]data2.Parameters, 0)
-
-	runs := 100
-
 	for _, r := range nValues {
 		for _, c := range rValues {
 			for _, serverLoad := range serverLoadValues {
 				for _, l := range lValues {
 					for _, x := range xValues {
 						if !((r == 1 && (x != 0.0 || l != 1)) || l > r || c <= r) {
-							if err := ctx.Err(); err != nil {
-								fmt.Printf("Stopping data collection: %v\n", err)
-								return
-							}
 							p := data2.Parameters{
 								C:          c,
 								R:          r,
@@ -296,14 +255,14 @@ func collectData(values ExpectedValues, ctx context.Context) {
 								X:          x,
 							}
 							d, present := getData(p)
-							if !present || len(d.Ratios) < runs {
-								num := runs
-								if d.Ratios != nil {
-									num = runs - len(d.Ratios)
-								}
-								for i := 0; i < num; i += numRunsPerCall {
-									index++
-									ps = append(ps, p)
+							if err := manifest.Add(p, runs, len(d.Ratios)); err != nil {
+								slog.Error("failed to add parameters to sweep", err)
+								return
+							}
+							if present {
+								if err := manifest.Measure(d); err != nil {
+									slog.Error("failed to measure the precision of a point", err)
+									return
 								}
 							}
 						}
@@ -313,57 +272,65 @@ func collectData(values ExpectedValues, ctx context.Context) {
 		}
 	}
 
-	utils.Shuffle(ps)
-
-	slog.Info("", "Numtimes", index)
+	progress := manifest.Progress()
+	slog.Info("Starting sweep", "Completed", progress.Completed, "Target", progress.Target, "Precise", progress.Precise, "Paused", progress.Paused)
 
 	var wg sync.WaitGroup
-
-	total := float64(index) / float64(runs)
-	index = 0
-
-	for _, p := range ps {
-		if err := ctx.Err(); err != nil {
-			fmt.Printf("Stopping data collection: %v\n", err)
-			wg.Wait()
-			return
-		}
-		index++
-		if index%3 == 0 {
-			wg.Wait()
-		}
+	for i := 0; i < concurrentJobs; i++ {
 		wg.Add(1)
-		go func(pp data2.Parameters, i int) {
+		go func() {
 			defer wg.Done()
-			calcData(pp, numRunsPerCall)
-			slog.Info(fmt.Sprintf("Done with  %f%%", float64(i)/total))
-		}(p, index)
+			for {
+				p, ok := manifest.Next(ctx)
+				if !ok {
+					return
+				}
+				v, err := calcData(ctx, p, 1)
+				if err == nil {
+					err = manifest.Measure(v)
+				}
+				if err != nil {
+					slog.Error("failed to collect data", err)
+				}
+				if err = manifest.Done(p, err); err != nil {
+					slog.Error("failed to update sweep manifest", err)
+				}
+				progress := manifest.Progress()
+				slog.Info("Sweep progress", "Completed", progress.Completed, "Target", progress.Target, "Precise", progress.Precise, "Failures", progress.Failures, "ETA", progress.ETA.Round(time.Second))
+			}
+		}()
 	}
 	wg.Wait()
+	if err := manifest.Flush(); err != nil {
+		slog.Error("failed to save sweep manifest", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		fmt.Printf("Stopping data collection: %v\n", err)
+		return
+	}
 	slog.Info("All data collected")
 }
 
-func packageData() {
-	// Marshal the updated struct back into JSON
-
-	slog.Info("Packaging data")
-
-	mu.RLock()
-	defer mu.RUnlock()
+// importLegacyData adds the results saved in path (if it exists) by earlier versions of the UI to the store.
+func importLegacyData(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
 
-	updatedJSON, err := json.MarshalIndent(cache, "", "  ")
+	legacy, err := data2.ReadResults(path)
 	if err != nil {
-		slog.Error("failed to marshal JSON", err)
-		return
+		return err
 	}
 
-	// Write the updated JSON back to the file
-	if err = ioutil.WriteFile(dataFile, updatedJSON, 0644); err != nil {
-		slog.Error("failed to write file", err)
-		return
-	}
+	slog.Info("Importing legacy data", "File", path, "Params", len(legacy))
 
-	slog.Info("All data collected")
+	for _, v := range legacy {
+		if _, err = setData(ctx, v.P, v); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func withHeaders(h http.Handler) http.Handler {
@@ -374,13 +341,7 @@ func withHeaders(h http.Handler) http.Handler {
 }
 
 func queryHandler(w http.ResponseWriter, r *http.Request) {
-	p := data2.Parameters{
-		C:          getIntQueryParam(r, "R"),
-		R:          getIntQueryParam(r, "N"),
-		ServerLoad: float64(getIntQueryParam(r, "ServerLoad")),
-		L:          getIntQueryParam(r, "L"),
-		X:          getFloatQueryParam(r, "X"),
-	}
+	p := getParametersQueryParam(r)
 	numRuns := getIntQueryParam(r, "NumRuns")
 	numBuckets := getIntQueryParam(r, "NumBuckets")
 
@@ -410,6 +371,69 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getParametersQueryParam returns the parameters selected by the sliders of index.html.
+func getParametersQueryParam(r *http.Request) data2.Parameters {
+	return data2.Parameters{
+		C:          getIntQueryParam(r, "R"),
+		R:          getIntQueryParam(r, "N"),
+		ServerLoad: float64(getIntQueryParam(r, "ServerLoad")),
+		L:          getIntQueryParam(r, "L"),
+		X:          getFloatQueryParam(r, "X"),
+	}
+}
+
+// privacyHandler reports the smallest ϵ for which (ϵ, Delta)-DP holds with the given Confidence (null if there are too
+// few trials to show it at any ϵ), along with the estimated (ϵ, δ) curve.
+func privacyHandler(w http.ResponseWriter, r *http.Request) {
+	p := getParametersQueryParam(r)
+	numRuns := getIntQueryParam(r, "NumRuns")
+	delta := getFloatQueryParam(r, "Delta")
+	if delta <= 0 {
+		delta = 0.05
+	}
+	confidence := getFloatQueryParam(r, "Confidence")
+	if confidence <= 0 || confidence >= 1 {
+		confidence = 0.95
+	}
+
+	v := getOrCalcData(p, numRuns)
+
+	if v.Ratios == nil || len(v.Ratios) == 0 {
+		http.Error(w, "No data available for the given parameters", http.StatusNotFound)
+		return
+	}
+
+	estimator := privacy.NewEstimator(v, confidence)
+
+	numPoints := 50
+	epsilons := make([]float64, numPoints)
+	for i := range epsilons {
+		epsilons[i] = math.Log(privacy.MaxRatio) * float64(i) / float64(numPoints-1)
+	}
+
+	response := struct {
+		Epsilon    *float64
+		Delta      float64
+		Confidence float64
+		NumRuns    int
+		Curve      []privacy.Point
+	}{
+		Delta:      delta,
+		Confidence: confidence,
+		NumRuns:    len(v.Ratios),
+		Curve:      estimator.Curve(epsilons),
+	}
+	if epsilon := estimator.Epsilon(delta); !math.IsInf(epsilon, 1) {
+		response.Epsilon = &epsilon
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("failed to encode response", err)
+		http.Error(w, "Failed to encode data to JSON", http.StatusInternalServerError)
+	}
+}
+
 func getIntQueryParam(r *http.Request, name string) int {
 	value, err := strconv.Atoi(r.URL.Query().Get(name))
 	if err != nil {
@@ -432,3 +456,85 @@ func handleExpectedValues(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to encode expected values to JSON", http.StatusInternalServerError)
 	}
 }
+
+// handleExport returns every trial collected so far as a table (see export.Columns), as CSV or as Parquet (?format=).
+// Every other query parameter is a condition on a parameter (see export.ParseFilter), e.g. ?C=100..1000&X=0.2.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	conditions := make(map[string]string)
+	for name := range query {
+		if name != "format" {
+			conditions[name] = query.Get(name)
+		}
+	}
+	filter, err := export.NewFilter(conditions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mu.RLock()
+	rows := export.Rows(cache, filter)
+	mu.RUnlock()
+
+	var buf bytes.Buffer
+	if err = export.Write(&buf, format, rows); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentTypes := map[string]string{
+		"csv":     "text/csv",
+		"parquet": "application/vnd.apache.parquet",
+	}
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=results.%s", format))
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		slog.Error("failed to write export", err)
+	}
+}
+
+// handleSweep reports the progress of the parameter sweep.
+func handleSweep(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	progress := manifest.Progress()
+	response := struct {
+		sweep.Progress
+		ETA string
+	}{
+		Progress: progress,
+		ETA:      progress.ETA.Round(time.Second).String(),
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode sweep progress to JSON", http.StatusInternalServerError)
+	}
+}
+
+func handlePauseSweep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := manifest.Pause(); err != nil {
+		slog.Error("failed to pause sweep", err)
+		http.Error(w, "Failed to pause sweep", http.StatusInternalServerError)
+		return
+	}
+	handleSweep(w, r)
+}
+
+func handleResumeSweep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := manifest.Resume(); err != nil {
+		slog.Error("failed to resume sweep", err)
+		http.Error(w, "Failed to resume sweep", http.StatusInternalServerError)
+		return
+	}
+	handleSweep(w, r)
+}
@@ -14,6 +14,8 @@ require (
 	github.com/lib/pq v1.10.7
 	go.uber.org/automaxprocs v1.5.1
 	golang.org/x/exp v0.0.0-20221026153819-32f3d567a233
+	gonum.org/v1/gonum v0.12.0
+	gonum.org/v1/plot v0.12.0
 	google.golang.org/protobuf v1.28.1
 )
 
@@ -40,8 +42,6 @@ require (
 	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
-	gonum.org/v1/gonum v0.12.0 // indirect
-	gonum.org/v1/plot v0.12.0 // indirect
 	google.golang.org/genproto v0.0.0-20221014213838-99cd37c6964a // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,110 @@
+package data
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Batch records how a run of consecutive trials of a Result was produced. Fields are left zero when unknown, as for
+// the trials of results upgraded from version 0.
+type Batch struct {
+	Id        string    `json:",omitempty"` // unique id of the run
+	NumTrials int       // number of trials of the run
+	Simulator string    `json:",omitempty"` // version of the simulator (see SimulatorVersion)
+	Seed      int64     `json:",omitempty"` // base seed of the run (trial i used simulation.TrialSeed(Seed, i))
+	Workers   int       `json:",omitempty"` // number of trials run in parallel
+	Started   time.Time // when the run started
+	Seconds   float64   `json:",omitempty"` // wall-clock duration of the run
+	Host      Host
+}
+
+// Host describes the machine a batch ran on.
+type Host struct {
+	Name      string `json:",omitempty"`
+	OS        string `json:",omitempty"`
+	Arch      string `json:",omitempty"`
+	NumCPU    int    `json:",omitempty"`
+	GoVersion string `json:",omitempty"`
+}
+
+// NewBatch returns the batch of numTrials trials run on this machine since started, from the given base seed.
+func NewBatch(numTrials int, seed int64, workers int, started time.Time) Batch {
+	hostname, _ := os.Hostname()
+	return Batch{
+		Id:        utils.GenerateUniqueHash()[:16],
+		NumTrials: numTrials,
+		Simulator: SimulatorVersion(),
+		Seed:      seed,
+		Workers:   workers,
+		Started:   started.UTC(),
+		Seconds:   time.Since(started).Seconds(),
+		Host: Host{
+			Name:      hostname,
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			NumCPU:    runtime.NumCPU(),
+			GoVersion: runtime.Version(),
+		},
+	}
+}
+
+// SimulatorVersion returns the version of the running simulator: the module version, followed by the VCS revision it
+// was built from (marked "+dirty" if the tree had uncommitted changes) when the build recorded it.
+func SimulatorVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	version := info.Main.Version
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision != "" {
+		version += "@" + revision
+		if modified {
+			version += "+dirty"
+		}
+	}
+	return version
+}
+
+// headBatches returns the batches of the first n trials.
+func headBatches(batches []Batch, n int) []Batch {
+	kept := make([]Batch, 0, len(batches))
+	for _, b := range batches {
+		if n <= 0 {
+			break
+		}
+		b.NumTrials = utils.Min(b.NumTrials, n)
+		n -= b.NumTrials
+		kept = append(kept, b)
+	}
+	return kept
+}
+
+// appendBatches returns the batches of a followed by those of b, merging the last batch of a and the first of b if they
+// are parts of the same run (as happens when a store returns every trial on its own).
+func appendBatches(a, b []Batch) []Batch {
+	return addBatches(append(make([]Batch, 0, len(a)+len(b)), a...), b)
+}
+
+// addBatches is appendBatches in place.
+func addBatches(batches, b []Batch) []Batch {
+	for _, batch := range b {
+		if last := len(batches) - 1; last >= 0 && batch.Id != "" && batches[last].Id == batch.Id {
+			batches[last].NumTrials += batch.NumTrials
+		} else {
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
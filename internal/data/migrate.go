@@ -0,0 +1,68 @@
+package data
+
+import (
+	"encoding/json"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReadResults reads a JSON object of results, such as static/data.json or static/olddata.json, written in any version
+// of the format. The results are upgraded to SchemaVersion and keyed by Parameters.Key, merging those that turn out
+// to have the same parameters.
+func ReadResults(path string) (map[string]Result, error) {
+	fileContent, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to read %s", path)
+	}
+
+	var stored map[string]Result
+	if err = json.Unmarshal(fileContent, &stored); err != nil {
+		return nil, pl.WrapError(err, "failed to unmarshal %s", path)
+	}
+
+	results := make(map[string]Result, len(stored))
+	for _, v := range stored {
+		if v, err = v.Upgrade(); err != nil {
+			return nil, pl.WrapError(err, "failed to upgrade results in %s", path)
+		}
+		key := v.P.Key()
+		if r, present := results[key]; present {
+			results[key] = r.Append(v)
+		} else {
+			results[key] = v
+		}
+	}
+	return results, nil
+}
+
+// WriteResults replaces the file at path with results, in the format read by ReadResults. The file is replaced
+// atomically, so it is never left half written.
+func WriteResults(path string, results map[string]Result) error {
+	content, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return pl.WrapError(err, "failed to marshal results")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return pl.WrapError(err, "failed to create temporary file for %s", path)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if err = tmp.Chmod(0644); err == nil {
+		_, err = tmp.Write(content)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return pl.WrapError(err, "failed to write results for %s", path)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return pl.WrapError(err, "failed to replace %s", path)
+	}
+	return nil
+}
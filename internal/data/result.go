@@ -2,31 +2,345 @@ package data
 
 import (
 	"fmt"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"hash/fnv"
+	"strconv"
+	"strings"
 )
 
 type Parameters struct {
-	C          int
-	R          int
-	X          float64
-	ServerLoad float64
-	L          int
-	str        string
+	C                int
+	R                int
+	X                float64
+	ServerLoad       float64
+	L                int
+	T                int       `json:",omitempty"` // checkpoint threshold: honest relays stop forwarding once more than T checkpoint onions are missing (0 disables)
+	BruiseThreshold  int       `json:",omitempty"` // honest relays discard onions with this many bruises (0 disables bruising)
+	Adversary        string    `json:",omitempty"` // name of the adversary strategy ("" is the default strategy)
+	Epochs           int       `json:",omitempty"` // number of epochs in which the clients send to the same receivers (0 means 1)
+	Pattern          string    `json:",omitempty"` // traffic pattern of the clients' messages, e.g. "zipf:1.5" ("" is a permutation)
+	XClients         float64   `json:",omitempty"` // fraction of the clients the adversary corrupts (never C_1 or C_2)
+	CorruptedClients []int     `json:",omitempty"` // clients the adversary always corrupts, counted towards XClients
+	Topology         string    `json:",omitempty"` // relay topology, e.g. "stratified" or "cascade:2" ("" is free-route)
+	RelayWeights     []float64 `json:",omitempty"` // weight (e.g. bandwidth) of each relay in path selection (empty is uniform)
+	str              string
+	key              string
 }
 
+// View holds, for every trial, the adversary's posterior probability that the target message went to C_{R-1}
+// (Pr0, i.e. that Scenario 0 was run) or to C_R (Pr1), and the ratio Pr0/Pr1. Aborted counts the honest relays
+// that stopped forwarding because of missing checkpoint onions. RoundRatios[i][l] is the ratio the adversary would
+// have computed in trial i had the onions been delivered right after round l (see rounds.Rounds.RoundRatios).
+//
+// With several epochs, the view is the one after intersecting the observations of every epoch, and EpochRatios[i][e]
+// is the ratio after the first e+1 epochs of trial i (RoundRatios isn't recorded then).
+//
+// Pr0 and Pr1 are not normalized the same way in both cases. With a single epoch, they are the raw posterior mass that
+// reaches each receiver, which need not sum to 1 over the receivers (e.g. when some of the target's onions are
+// dropped). With several epochs, they are normalized over the receivers. Ratios don't depend on this.
+type View struct {
+	Pr0         []float64
+	Pr1         []float64
+	Ratios      []float64
+	Aborted     []int       `json:",omitempty"`
+	RoundRatios [][]float64 `json:",omitempty"`
+	EpochRatios [][]float64 `json:",omitempty"`
+}
+
+// SchemaVersion is the version of the Result format written by this code. Results that don't record a Version were
+// written before the format was versioned and are version 0 (see Result.Upgrade).
+const SchemaVersion = 1
+
+// Result holds the adversary's view in Scenario 0 (embedded, for compatibility with results recorded before both
+// scenarios were simulated) and in Scenario 1.
 type Result struct {
-	P      Parameters
-	Pr0    []float64
-	Pr1    []float64
-	Ratios []float64
+	Version int // format version (see SchemaVersion)
+	P       Parameters
+	View
+	Seeds     []int64 // Seeds[i] is the RNG seed of trial i; re-running it with numRuns=1 reproduces the trial
+	Scenario1 View
+	Batches   []Batch `json:",omitempty"` // how the trials were run: the first Batches[0].NumTrials by the first batch, and so on
+}
+
+// Upgrade returns r in the current format. Version 0 results gain a single batch of unknown provenance holding all of
+// their trials. Results written in a newer format than SchemaVersion can't be upgraded.
+func (r Result) Upgrade() (Result, error) {
+	if r.Version > SchemaVersion {
+		return r, pl.NewError("result for %s has version %d, but only versions up to %d are supported", r.P.Hash(), r.Version, SchemaVersion)
+	}
+	return r.upgraded(), nil
 }
 
+func (r Result) upgraded() Result {
+	if r.Version == 0 {
+		if len(r.Batches) == 0 && len(r.Ratios) > 0 {
+			r.Batches = []Batch{{NumTrials: len(r.Ratios)}}
+		}
+		r.Version = SchemaVersion
+	}
+	return r
+}
+
+// Scenario returns the adversary's view recorded for the given scenario (0 or 1).
+func (r Result) Scenario(scenario int) View {
+	if scenario == 0 {
+		return r.View
+	}
+	return r.Scenario1
+}
+
+// HasBothScenarios reports whether r holds a Scenario 1 view for every Scenario 0 trial.
+func (r Result) HasBothScenarios() bool {
+	return len(r.Scenario1.Ratios) > 0 && len(r.Scenario1.Ratios) == len(r.Ratios)
+}
+
+// Head returns the first n trials of r (or all of them if there are fewer than n). It shares the values of the trials
+// with r but not its batches, so it stays valid while r grows with AppendTrials.
+func (r Result) Head(n int) Result {
+	return Result{
+		Version:   r.Version,
+		P:         r.P,
+		View:      r.View.head(n),
+		Seeds:     head(r.Seeds, n),
+		Scenario1: r.Scenario1.head(n),
+		Batches:   headBatches(r.Batches, n),
+	}
+}
+
+// Append returns r with the trials of v added after its own, in the current format, without sharing memory with
+// either. Every per-trial slice of the result holds trial i at index i: Aborted, RoundRatios and EpochRatios are padded
+// (with 0 and nil) for the trials of a result that didn't record them, e.g. one recorded before they existed, while the
+// Seeds and the Scenario 1 view, which can't be made up, are only kept if both results record them for every trial.
+func (r Result) Append(v Result) Result {
+	r, v = r.upgraded(), v.upgraded()
+	n, m := len(r.Ratios), len(v.Ratios)
+	result := Result{
+		Version: SchemaVersion,
+		P:       r.P,
+		View:    r.View.append(v.View),
+		Batches: appendBatches(r.Batches, v.Batches),
+	}
+	if len(r.Seeds) == n && len(v.Seeds) == m {
+		result.Seeds = concat(r.Seeds, n, v.Seeds, m)
+	}
+	if len(r.Scenario1.Ratios) == n && len(v.Scenario1.Ratios) == m {
+		result.Scenario1 = r.Scenario1.append(v.Scenario1)
+	}
+	return result
+}
+
+// AppendTrials adds the trials of v after those of r in place. It is Append, but in amortized time proportional to the
+// trials of v, as it extends the slices of r instead of copying them: use it to accumulate trials as they complete,
+// and Append to merge two results. r must not share its slices with another result, except one returned by r.Head,
+// which AppendTrials never modifies.
+func (r *Result) AppendTrials(v Result) {
+	if len(r.Ratios) == 0 && len(r.Batches) == 0 {
+		r.P = v.P
+	}
+	*r, v = r.upgraded(), v.upgraded()
+	n, m := len(r.Ratios), len(v.Ratios)
+	if len(r.Seeds) == n && len(v.Seeds) == m {
+		r.Seeds = extend(r.Seeds, n, v.Seeds, m)
+	} else {
+		r.Seeds = nil
+	}
+	if len(r.Scenario1.Ratios) == n && len(v.Scenario1.Ratios) == m {
+		r.Scenario1.extend(v.Scenario1)
+	} else {
+		r.Scenario1 = View{}
+	}
+	r.View.extend(v.View)
+	r.Batches = addBatches(r.Batches, v.Batches)
+}
+
+// AfterEpoch returns the ratios of r after intersecting the observations of its first e epochs (1 <= e <= P.Epochs).
+// Only the ratios are kept.
+func (r Result) AfterEpoch(e int) Result {
+	return Result{
+		Version:   r.Version,
+		P:         r.P,
+		View:      r.View.afterEpoch(e),
+		Seeds:     r.Seeds,
+		Scenario1: r.Scenario1.afterEpoch(e),
+		Batches:   r.Batches,
+	}
+}
+
+func (v View) afterEpoch(e int) View {
+	ratios := make([]float64, len(v.EpochRatios))
+	for i, epochRatios := range v.EpochRatios {
+		ratios[i] = epochRatios[e-1]
+	}
+	return View{Ratios: ratios}
+}
+
+func (v View) head(n int) View {
+	return View{
+		Pr0:         head(v.Pr0, n),
+		Pr1:         head(v.Pr1, n),
+		Ratios:      head(v.Ratios, n),
+		Aborted:     head(v.Aborted, n),
+		RoundRatios: head(v.RoundRatios, n),
+		EpochRatios: head(v.EpochRatios, n),
+	}
+}
+
+func (v View) append(w View) View {
+	n, m := len(v.Ratios), len(w.Ratios)
+	return View{
+		Pr0:         concat(v.Pr0, n, w.Pr0, m),
+		Pr1:         concat(v.Pr1, n, w.Pr1, m),
+		Ratios:      concat(v.Ratios, n, w.Ratios, m),
+		Aborted:     concat(v.Aborted, n, w.Aborted, m),
+		RoundRatios: concat(v.RoundRatios, n, w.RoundRatios, m),
+		EpochRatios: concat(v.EpochRatios, n, w.EpochRatios, m),
+	}
+}
+
+// extend is append in place.
+func (v *View) extend(w View) {
+	n, m := len(v.Ratios), len(w.Ratios)
+	v.Pr0 = extend(v.Pr0, n, w.Pr0, m)
+	v.Pr1 = extend(v.Pr1, n, w.Pr1, m)
+	v.Ratios = extend(v.Ratios, n, w.Ratios, m)
+	v.Aborted = extend(v.Aborted, n, w.Aborted, m)
+	v.RoundRatios = extend(v.RoundRatios, n, w.RoundRatios, m)
+	v.EpochRatios = extend(v.EpochRatios, n, w.EpochRatios, m)
+}
+
+// extend is concat in place: it pads a to n values, then appends the first m values of b (padded likewise), growing a
+// with the built-in append.
+func extend[T any](a []T, n int, b []T, m int) []T {
+	if len(a) == 0 && len(b) == 0 {
+		return a
+	}
+	var zero T
+	a = head(a, n)
+	for len(a) < n {
+		a = append(a, zero)
+	}
+	a = append(a, head(b, m)...)
+	for len(a) < n+m {
+		a = append(a, zero)
+	}
+	return a
+}
+
+// concat returns a new slice holding the first n values of a followed by the first m values of b, padding either
+// with zero values if it is shorter, or nil if neither holds any values.
+func concat[T any](a []T, n int, b []T, m int) []T {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	values := make([]T, n+m)
+	copy(values, head(a, n))
+	copy(values[n:], head(b, m))
+	return values
+}
+
+func head[T any](values []T, n int) []T {
+	if len(values) > n {
+		return values[:n]
+	}
+	return values
+}
+
+// Hash returns a short name for p, used in logs and as the key of the data.json files written before results were
+// versioned. It rounds X and ServerLoad, so different parameters may share a Hash; use Key to tell them apart.
 func (p *Parameters) Hash() string {
 	if p.str == "" {
 		p.str = fmt.Sprintf("%d-%d-%d-%d-%d", p.C, p.R, int(p.X*float64(p.R)), int(p.ServerLoad), p.L)
+		if p.T != 0 {
+			p.str += fmt.Sprintf("-t%d", p.T)
+		}
+		if p.BruiseThreshold != 0 {
+			p.str += fmt.Sprintf("-b%d", p.BruiseThreshold)
+		}
+		if p.Adversary != "" && p.Adversary != "default" {
+			p.str += "-" + p.Adversary
+		}
+		if p.Epochs > 1 {
+			p.str += fmt.Sprintf("-e%d", p.Epochs)
+		}
+		if p.Pattern != "" && p.Pattern != "permutation" {
+			p.str += "-" + p.Pattern
+		}
+		if p.XClients != 0 {
+			p.str += fmt.Sprintf("-xc%d", int(p.XClients*float64(p.C)))
+		}
+		if len(p.CorruptedClients) > 0 {
+			p.str += "-cc" + strings.Join(utils.Map(p.CorruptedClients, strconv.Itoa), ".")
+		}
+		if p.Topology != "" && p.Topology != "free" {
+			p.str += "-" + p.Topology
+		}
+		if len(p.RelayWeights) > 0 {
+			// the weights are too long to spell out, so they are identified by their hash
+			h := fnv.New32a()
+			for _, weight := range p.RelayWeights {
+				_, _ = fmt.Fprintf(h, "%g,", weight)
+			}
+			p.str += fmt.Sprintf("-w%08x", h.Sum32())
+		}
 	}
 	return p.str
 }
 
+// Key returns the canonical key of p: every parameter that differs from its default, spelled out exactly, so that two
+// sets of parameters share a Key only if they describe the same simulation. Parameters added later only appear in the
+// keys that set them, so existing keys stay valid.
+func (p *Parameters) Key() string {
+	if p.key == "" {
+		fields := []string{
+			"C=" + strconv.Itoa(p.C),
+			"R=" + strconv.Itoa(p.R),
+			"X=" + formatFloat(p.X),
+			"ServerLoad=" + formatFloat(p.ServerLoad),
+			"L=" + strconv.Itoa(p.L),
+		}
+		if p.T != 0 {
+			fields = append(fields, "T="+strconv.Itoa(p.T))
+		}
+		if p.BruiseThreshold != 0 {
+			fields = append(fields, "BruiseThreshold="+strconv.Itoa(p.BruiseThreshold))
+		}
+		if p.Adversary != "" && p.Adversary != "default" {
+			fields = append(fields, "Adversary="+p.Adversary)
+		}
+		if p.Epochs > 1 {
+			fields = append(fields, "Epochs="+strconv.Itoa(p.Epochs))
+		}
+		if p.Pattern != "" && p.Pattern != "permutation" {
+			fields = append(fields, "Pattern="+p.Pattern)
+		}
+		if p.XClients != 0 {
+			fields = append(fields, "XClients="+formatFloat(p.XClients))
+		}
+		if len(p.CorruptedClients) > 0 {
+			// the corrupted clients are a set, so their order (and any repeats) doesn't change the simulation
+			clients := utils.RemoveDuplicates(p.CorruptedClients)
+			utils.SortOrdered(clients)
+			fields = append(fields, "CorruptedClients="+strings.Join(utils.Map(clients, strconv.Itoa), "."))
+		}
+		if p.Topology != "" && p.Topology != "free" {
+			fields = append(fields, "Topology="+p.Topology)
+		}
+		if len(p.RelayWeights) > 0 {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(strings.Join(utils.Map(p.RelayWeights, formatFloat), ",")))
+			fields = append(fields, fmt.Sprintf("RelayWeights=%016x", h.Sum64()))
+		}
+		p.key = strings.Join(fields, ",")
+	}
+	return p.key
+}
+
+// formatFloat formats f with as few digits as parse back to exactly f.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
 func (p *Parameters) Equals(p2 *Parameters) bool {
-	return p.Hash() == p2.Hash()
+	return p.Key() == p2.Key()
 }
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParameters_Key(t *testing.T) {
+	p1 := Parameters{C: 1000, R: 10, X: 0.21, ServerLoad: 100.5, L: 3}
+	p2 := Parameters{C: 1000, R: 10, X: 0.22, ServerLoad: 100.9, L: 3}
+	if p1.Hash() != p2.Hash() {
+		t.Fatalf("Expected %s and %s to share a Hash", p1.Key(), p2.Key())
+	}
+	if p1.Key() == p2.Key() {
+		t.Fatalf("Expected different keys, got %s", p1.Key())
+	}
+	if key := p1.Key(); key != "C=1000,R=10,X=0.21,ServerLoad=100.5,L=3" {
+		t.Fatalf("Unexpected key %s", key)
+	}
+
+	defaults := Parameters{C: 1000, R: 10, X: 0.21, ServerLoad: 100.5, L: 3, Adversary: "default", Epochs: 1, Pattern: "permutation", Topology: "free"}
+	if defaults.Key() != p1.Key() {
+		t.Fatalf("Expected the defaults to be left out of the key, got %s", defaults.Key())
+	}
+
+	corrupted := []int{7, 3, 5, 3}
+	p3 := Parameters{C: 1000, R: 10, X: 0.21, ServerLoad: 100.5, L: 3, CorruptedClients: corrupted}
+	p4 := Parameters{C: 1000, R: 10, X: 0.21, ServerLoad: 100.5, L: 3, CorruptedClients: []int{3, 5, 7}}
+	if p3.Key() != p4.Key() {
+		t.Fatalf("Expected the order of the corrupted clients not to change the key, got %s and %s", p3.Key(), p4.Key())
+	}
+	if corrupted[0] != 7 || corrupted[1] != 3 {
+		t.Fatalf("Expected Key not to reorder the corrupted clients, got %v", corrupted)
+	}
+}
+
+func TestReadResults_UpgradesLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	legacy := `{
+		"1000-10-2-100-3": {"P": {"C": 1000, "R": 10, "X": 0.2, "ServerLoad": 100, "L": 3}, "Pr0": [0.5, 0.25], "Pr1": [0.5, 0.5], "Ratios": [1, 0.5]},
+		"20-5-1-10-2": {"P": {"C": 20, "R": 5, "X": 0.2, "ServerLoad": 10, "L": 2}, "Pr0": [0.1], "Pr1": [0.2], "Ratios": [0.5]}
+	}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	results, err := ReadResults(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = WriteResults(path, results); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if results, err = ReadResults(path); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	p := Parameters{C: 1000, R: 10, X: 0.2, ServerLoad: 100, L: 3}
+	v, present := results[p.Key()]
+	if len(results) != 2 || !present {
+		t.Fatalf("Expected 2 results keyed by Parameters.Key, got %v", len(results))
+	}
+	if v.Version != SchemaVersion || len(v.Batches) != 1 || v.Batches[0].NumTrials != 2 {
+		t.Fatalf("Expected a version %d result with one batch of 2 trials, got version %d with batches %+v", SchemaVersion, v.Version, v.Batches)
+	}
+
+	// trials appended later keep their own provenance
+	batch := NewBatch(1, 42, 1, time.Now())
+	v = v.Append(Result{Version: SchemaVersion, P: p, View: View{Pr0: []float64{1}, Pr1: []float64{1}, Ratios: []float64{1}}, Batches: []Batch{batch}})
+	v = v.Append(Result{Version: SchemaVersion, P: p, View: View{Pr0: []float64{1}, Pr1: []float64{1}, Ratios: []float64{1}}, Batches: []Batch{batch}})
+	if len(v.Batches) != 2 || v.Batches[1].NumTrials != 2 || v.Batches[1].Seed != 42 {
+		t.Fatalf("Expected the appended trials to form a second batch, got %+v", v.Batches)
+	}
+	if head := v.Head(3); len(head.Batches) != 2 || head.Batches[1].NumTrials != 1 {
+		t.Fatalf("Expected the first 3 trials to span both batches, got %+v", head.Batches)
+	}
+
+	if _, err = (Result{Version: SchemaVersion + 1}).Upgrade(); err == nil {
+		t.Fatalf("Expected an error upgrading a result from a newer version")
+	}
+}
+
+func TestResult_AppendKeepsTrialsAligned(t *testing.T) {
+	p := Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+	// recorded before seeds, Scenario 1 and aborts were, with spare capacity in its slices
+	legacy := Result{P: p, View: View{
+		Pr0:    append(make([]float64, 0, 10), 0.5, 0.4),
+		Pr1:    append(make([]float64, 0, 10), 0.5, 0.6),
+		Ratios: append(make([]float64, 0, 10), 1, 0.4/0.6),
+	}}
+	current := Result{
+		Version:   SchemaVersion,
+		P:         p,
+		View:      View{Pr0: []float64{0.9}, Pr1: []float64{0.1}, Ratios: []float64{9}, Aborted: []int{2}, RoundRatios: [][]float64{{1, 9}}},
+		Seeds:     []int64{42},
+		Scenario1: View{Pr0: []float64{0.2}, Pr1: []float64{0.8}, Ratios: []float64{0.25}, Aborted: []int{1}},
+	}
+
+	r := legacy.Append(current)
+	if len(r.Ratios) != 3 || len(r.Aborted) != 3 || len(r.RoundRatios) != 3 {
+		t.Fatalf("Expected 3 trials in every recorded slice, got %+v", r.View)
+	}
+	if trial := r.Trial(2); trial.Ratio != 9 || trial.Aborted != 2 || len(trial.RoundRatios) != 2 {
+		t.Fatalf("Expected trial 2 to be the appended one, got %+v", trial)
+	}
+	if trial := r.Trial(0); trial.Aborted != 0 || trial.RoundRatios != nil {
+		t.Fatalf("Expected trial 0 to record no aborts or round ratios, got %+v", trial)
+	}
+	if r.Seeds != nil || r.Scenario1.Ratios != nil || r.HasBothScenarios() {
+		t.Fatalf("Expected the seeds and Scenario 1 to be left out, got %v and %+v", r.Seeds, r.Scenario1)
+	}
+
+	// appending to the same result twice doesn't overwrite the first append
+	other := legacy.Append(Result{P: p, View: View{Pr0: []float64{0}, Pr1: []float64{1}, Ratios: []float64{0}}})
+	if r.Ratios[2] != 9 || other.Ratios[2] != 0 || legacy.Ratios[:3][2] != 0 {
+		t.Fatalf("Expected Append not to share memory, got %v, %v and %v", r.Ratios, other.Ratios, legacy.Ratios[:3])
+	}
+
+	both := current.Append(current)
+	if len(both.Seeds) != 2 || !both.HasBothScenarios() || len(both.Scenario1.Aborted) != 2 || both.Scenario1.RoundRatios != nil {
+		t.Fatalf("Expected the seeds and Scenario 1 of both results, got %+v", both)
+	}
+}
+
+func TestResult_AppendTrialsMatchesAppend(t *testing.T) {
+	p := Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+	legacy := Result{P: p, View: View{Pr0: []float64{0.5, 0.4}, Pr1: []float64{0.5, 0.6}, Ratios: []float64{1, 0.4 / 0.6}}}
+	trial := func(ratio float64, batch string) Result {
+		return Result{
+			Version:   SchemaVersion,
+			P:         p,
+			View:      View{Pr0: []float64{ratio / 2}, Pr1: []float64{0.5}, Ratios: []float64{ratio}, Aborted: []int{1}},
+			Seeds:     []int64{int64(ratio)},
+			Scenario1: View{Pr0: []float64{0.5}, Pr1: []float64{ratio / 2}, Ratios: []float64{1 / ratio}},
+			Batches:   []Batch{{Id: batch, NumTrials: 1}},
+		}
+	}
+
+	for _, start := range []Result{{}, legacy, trial(3, "a")} {
+		expected, r := start, start
+		if len(start.Ratios) > 0 {
+			// accumulate into a result of its own, as AppendTrials requires
+			r = start.Append(Result{})
+		}
+		for i, batch := range []string{"a", "a", "b", "c", "c"} {
+			if len(expected.Ratios) == 0 {
+				expected = trial(float64(i+1), batch).upgraded()
+			} else {
+				expected = expected.Append(trial(float64(i+1), batch))
+			}
+			snapshot := r.Head(len(r.Ratios))
+			before := fmt.Sprintf("%+v", snapshot)
+			r.AppendTrials(trial(float64(i+1), batch))
+			if after := fmt.Sprintf("%+v", snapshot); after != before {
+				t.Fatalf("Expected AppendTrials to leave the result of Head unchanged, got %s instead of %s", after, before)
+			}
+		}
+		if !reflect.DeepEqual(r, expected) {
+			t.Fatalf("Expected AppendTrials to match Append:\n%+v\n%+v", r, expected)
+		}
+	}
+}
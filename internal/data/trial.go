@@ -0,0 +1,54 @@
+package data
+
+// Trial is a single trial of a Result, as written one per line by cmd/simulation -output jsonl. Like Result, it
+// embeds the adversary's view in Scenario 0.
+type Trial struct {
+	Version int
+	Key     string // Parameters.Key of the parameters the trial was run with
+	Index   int    // index of the trial in its run
+	Seed    int64
+	TrialView
+	Scenario1 TrialView
+}
+
+// TrialView is the adversary's view of a single trial in one scenario (see View).
+type TrialView struct {
+	Pr0         float64
+	Pr1         float64
+	Ratio       float64
+	Aborted     int       `json:",omitempty"`
+	RoundRatios []float64 `json:",omitempty"`
+	EpochRatios []float64 `json:",omitempty"`
+}
+
+// Trial returns trial i of r.
+func (r Result) Trial(i int) Trial {
+	t := Trial{
+		Version:   r.Version,
+		Key:       r.P.Key(),
+		Index:     i,
+		TrialView: r.View.trial(i),
+		Scenario1: r.Scenario1.trial(i),
+	}
+	if i < len(r.Seeds) {
+		t.Seed = r.Seeds[i]
+	}
+	return t
+}
+
+func (v View) trial(i int) TrialView {
+	var t TrialView
+	if i < len(v.Ratios) {
+		t.Pr0, t.Pr1, t.Ratio = v.Pr0[i], v.Pr1[i], v.Ratios[i]
+	}
+	if i < len(v.Aborted) {
+		t.Aborted = v.Aborted[i]
+	}
+	if i < len(v.RoundRatios) {
+		t.RoundRatios = v.RoundRatios[i]
+	}
+	if i < len(v.EpochRatios) {
+		t.EpochRatios = v.EpochRatios[i]
+	}
+	return t
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// RelayWeightsConfig is the config file format for relay weights (a relay's bandwidth or capacity, in any unit). Path
+// selection picks relays in proportion to their weight. For example, in YAML:
+//
+//	default: 1
+//	relays:
+//	  - relay: 1
+//	    weight: 10
+type RelayWeightsConfig struct {
+	Default float64       `yaml:"default" json:"default" toml:"default" env-default:"1"` // weight of the relays not listed
+	Relays  []RelayWeight `yaml:"relays" json:"relays" toml:"relays"`
+}
+
+// RelayWeight is the weight of a single relay.
+type RelayWeight struct {
+	Relay  int     `yaml:"relay" json:"relay" toml:"relay"` // index of the relay, from 1 to R
+	Weight float64 `yaml:"weight" json:"weight" toml:"weight"`
+}
+
+// LoadRelayWeights reads a YAML, JSON or TOML config file (see RelayWeightsConfig) and returns the weights of the R
+// relays, in relay order.
+func LoadRelayWeights(path string, R int) ([]float64, error) {
+	var config RelayWeightsConfig
+	if err := cleanenv.ReadConfig(path, &config); err != nil {
+		return nil, pl.WrapError(err, "failed to read relay weights from %s", path)
+	}
+	if config.Default < 0 {
+		return nil, pl.NewError("negative default weight %f", config.Default)
+	}
+
+	weights := make([]float64, R)
+	for i := range weights {
+		weights[i] = config.Default
+	}
+	for _, w := range config.Relays {
+		if w.Relay < 1 || w.Relay > R {
+			return nil, pl.NewError("relay %d is out of range (expected 1 to %d)", w.Relay, R)
+		}
+		if w.Weight < 0 {
+			return nil, pl.NewError("relay %d has negative weight %f", w.Relay, w.Weight)
+		}
+		weights[w.Relay-1] = w.Weight
+	}
+	return weights, nil
+}
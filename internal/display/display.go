@@ -43,7 +43,12 @@ func PlotView(v data2.Result, numBuckets int) (Images, error) {
 		return Images{}, pl.WrapError(err, "failed to create CDF plot")
 	}
 
-	epDelta, err := createEpsilonDeltaPlot(v.Ratios)
+	var epDelta string
+	if v.HasBothScenarios() {
+		epDelta, err = createScenarioEpsilonDeltaPlot(v.Ratios, v.Scenario1.Ratios, numBuckets)
+	} else {
+		epDelta, err = createEpsilonDeltaPlot(v)
+	}
 	if err != nil {
 		return Images{}, pl.WrapError(err, "failed to create CDF plot")
 	}
@@ -3,6 +3,8 @@ package display
 import (
 	"fmt"
 	pl "github.com/HannahMarsh/PrettyLogger"
+	data2 "github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/privacy"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
@@ -144,32 +146,27 @@ func createFloatCDFPlot(file string, probabilities []pair, title, xLabel, yLabel
 	return newName, nil
 }
 
-func createEpsilonDeltaPlot(ratios []float64) (string, error) {
+// createEpsilonDeltaPlot plots privacy.Estimator's estimate of δ for a range of ϵ, for results recorded before both
+// scenarios were simulated (δ(ϵ) is then the fraction of trials whose ratio exceeds e^ϵ).
+func createEpsilonDeltaPlot(v data2.Result) (string, error) {
+	// only the estimate is plotted, which doesn't depend on the confidence
+	estimator := privacy.NewEstimator(v, 0.95)
 
-	//fmt.Printf("\nR=\\left[%s\\right]\n", strings.Join(utils.Map(ratios, func(ratio float64) string {
-	//	return fmt.Sprintf("%.7f", ratio)
-	//}), ","))
-
-	epsilonValues := utils.Map(ratios, func(ratio float64) float64 {
-		return math.Log(ratio)
-	})
+	numPoints := 50
+	epsilonValues := make([]float64, numPoints)
+	for i := range epsilonValues {
+		epsilonValues[i] = math.Log(privacy.MaxRatio) * float64(i) / float64(numPoints-1)
+	}
 
 	minDelta := 1.0
-
-	deltaValues := utils.Map(epsilonValues, func(epsilon float64) float64 {
-		bound := math.Pow(math.E, epsilon)
-		fracThatExceeded := utils.Mean(utils.Map(ratios, func(ratio float64) float64 {
-			if ratio > bound {
-				return 1.0
-			}
-			return 0.0
-		}))
-		if fracThatExceeded > 0.0 && fracThatExceeded < minDelta {
-			minDelta = fracThatExceeded
+	deltaValues := utils.Map(estimator.Curve(epsilonValues), func(point privacy.Point) float64 {
+		if point.Delta > 0.0 && point.Delta < minDelta {
+			minDelta = point.Delta
 		}
-		return fracThatExceeded
+		return point.Delta
 	})
 
+	// the y-axis is logarithmic, so a δ of 0 is drawn below the smallest positive one
 	deltaValues = utils.Map(deltaValues, func(delta float64) float64 {
 		if delta <= 0.0 {
 			return math.Max(0.0001, minDelta/2.0)
@@ -181,6 +178,86 @@ func createEpsilonDeltaPlot(ratios []float64) (string, error) {
 	return guess(epsilonValues, deltaValues, "Epsilon", "Delta", "Values of ϵ and δ for which (ϵ,δ)-DP is Satisfied", "Epsilon-Delta", "epsilon_delta")
 }
 
+// createScenarioEpsilonDeltaPlot estimates, for a range of ϵ, the smallest δ such that
+// Pr[View(σ0) ∈ V] ≤ e^ϵ·Pr[View(σ1) ∈ V] + δ (and vice versa) holds for every set V of views. Views are
+// summarised by the adversary's log ratio and binned, and δ is the hockey-stick divergence between the two
+// empirical view distributions.
+func createScenarioEpsilonDeltaPlot(ratios0, ratios1 []float64, numBuckets int) (string, error) {
+	numBuckets = utils.Max(numBuckets, 5)
+
+	logRatios0 := utils.Map(ratios0, logRatio)
+	logRatios1 := utils.Map(ratios1, logRatio)
+
+	all := append(utils.Copy(logRatios0), logRatios1...)
+	xMin := utils.MinOver(all)
+	xMax := utils.MaxOver(all)
+
+	p0 := binFrequencies(logRatios0, xMin, xMax, numBuckets)
+	p1 := binFrequencies(logRatios1, xMin, xMax, numBuckets)
+
+	// the largest ϵ worth plotting is the one at which no bin exceeds its bound any more
+	epsilonMax := 0.0
+	for b := range p0 {
+		if p0[b] > 0 && p1[b] > 0 {
+			epsilonMax = math.Max(epsilonMax, math.Abs(math.Log(p0[b]/p1[b])))
+		}
+	}
+	epsilonMax = math.Max(epsilonMax, 1.0)
+
+	numPoints := 50
+	epsilonValues := make([]float64, numPoints)
+	deltaValues := make([]float64, numPoints)
+	minDelta := 1.0
+	for i := range epsilonValues {
+		epsilon := epsilonMax * float64(i) / float64(numPoints-1)
+		delta := math.Max(hockeyStick(p0, p1, epsilon), hockeyStick(p1, p0, epsilon))
+		if delta > 0.0 && delta < minDelta {
+			minDelta = delta
+		}
+		epsilonValues[i] = epsilon
+		deltaValues[i] = delta
+	}
+
+	deltaValues = utils.Map(deltaValues, func(delta float64) float64 {
+		if delta <= 0.0 {
+			return math.Max(0.0001, minDelta/2.0)
+		} else {
+			return delta
+		}
+	})
+
+	return guess(epsilonValues, deltaValues, "Epsilon", "Delta", "Values of ϵ and δ for which (ϵ,δ)-DP is Satisfied (Scenario 0 vs. Scenario 1)", "Epsilon-Delta", "epsilon_delta")
+}
+
+// logRatio returns log(ratio), clamped to the same [1/1000, 1000] range that Rounds.GetRatio uses for
+// one-sided views so that a zero posterior doesn't produce -Inf.
+func logRatio(ratio float64) float64 {
+	return math.Log(math.Min(math.Max(ratio, 1.0/1000.0), 1000.0))
+}
+
+// binFrequencies returns the fraction of values falling in each of numBuckets equal-width bins over [xMin, xMax].
+func binFrequencies(values []float64, xMin, xMax float64, numBuckets int) []float64 {
+	freq := make([]float64, numBuckets)
+	width := (xMax - xMin) / float64(numBuckets)
+	for _, value := range values {
+		b := 0
+		if width > 0 {
+			b = utils.Min(int((value-xMin)/width), numBuckets-1)
+		}
+		freq[b] += 1.0 / float64(len(values))
+	}
+	return freq
+}
+
+// hockeyStick returns Σ_b max(0, p(b) - e^ϵ·q(b)), the δ needed for the bound Pr_p[V] ≤ e^ϵ·Pr_q[V] + δ.
+func hockeyStick(p, q []float64, epsilon float64) float64 {
+	delta := 0.0
+	for b := range p {
+		delta += math.Max(0.0, p[b]-math.Exp(epsilon)*q[b])
+	}
+	return delta
+}
+
 func createRatiosPlot(prob0, prob1 []float64) (string, error) {
 
 	mean0 := utils.Mean(prob0)
@@ -0,0 +1,32 @@
+package export
+
+import (
+	"encoding/csv"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"io"
+)
+
+// writeCSV writes rows as CSV with a header row. Missing values are left empty.
+func writeCSV(w io.Writer, rows []Row) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns()); err != nil {
+		return pl.WrapError(err, "failed to write CSV header")
+	}
+	record := make([]string, len(columns))
+	for i := range rows {
+		for j, c := range columns {
+			record[j] = ""
+			if value, present := c.value(&rows[i]); present {
+				record[j] = format(c.kind, value)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return pl.WrapError(err, "failed to write CSV row %d", i)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return pl.WrapError(err, "failed to write CSV")
+	}
+	return nil
+}
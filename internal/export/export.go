@@ -0,0 +1,147 @@
+package export
+
+import (
+	"encoding/json"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Formats are the formats accepted by Write.
+var Formats = []string{"csv", "parquet"}
+
+// Row is a single trial of a stored result, along with the parameters it was run with.
+type Row struct {
+	P data.Parameters
+	data.Trial
+	hasSeed, hasScenario1 bool
+}
+
+// Rows flattens results into one row per trial of every result whose parameters match filter (every result if filter
+// is nil), ordered by Parameters.Key and then by trial.
+func Rows(results map[string]data.Result, filter *Filter) []Row {
+	keys := utils.GetKeys(results)
+	sort.Strings(keys)
+	rows := make([]Row, 0)
+	for _, key := range keys {
+		v := results[key]
+		if filter != nil && !filter.Matches(v.P) {
+			continue
+		}
+		for i := range v.Ratios {
+			rows = append(rows, Row{
+				P:            v.P,
+				Trial:        v.Trial(i),
+				hasSeed:      i < len(v.Seeds),
+				hasScenario1: i < len(v.Scenario1.Ratios),
+			})
+		}
+	}
+	return rows
+}
+
+// Write writes rows to w as a table in the given format (one of Formats), with one column per parameter and per
+// value recorded for a trial (see Columns).
+func Write(w io.Writer, format string, rows []Row) error {
+	switch format {
+	case "csv":
+		return writeCSV(w, rows)
+	case "parquet":
+		return writeParquet(w, rows)
+	default:
+		return pl.NewError("unknown export format %q (expected one of %v)", format, Formats)
+	}
+}
+
+// kind is the type of the values of a column.
+type kind int
+
+const (
+	intKind kind = iota
+	floatKind
+	stringKind
+)
+
+// column is a column of the exported table. value returns the value of the column in a row (an int64, float64 or
+// string, according to kind), or false if the row has none.
+type column struct {
+	name      string
+	kind      kind
+	parameter bool // whether the column holds a parameter, by which results can be filtered
+	value     func(r *Row) (interface{}, bool)
+}
+
+// Columns returns the names of the columns of the exported table, in order.
+func Columns() []string {
+	return utils.Map(columns, func(c column) string {
+		return c.name
+	})
+}
+
+// columns are the columns of the exported table. Parameters left at their default are spelled out (e.g. Adversary is
+// "default" rather than empty), and lists are written as JSON arrays.
+var columns = []column{
+	{name: "Key", kind: stringKind, value: func(r *Row) (interface{}, bool) { return r.Key, true }},
+	{name: "C", kind: intKind, parameter: true, value: func(r *Row) (interface{}, bool) { return int64(r.P.C), true }},
+	{name: "R", kind: intKind, parameter: true, value: func(r *Row) (interface{}, bool) { return int64(r.P.R), true }},
+	{name: "X", kind: floatKind, parameter: true, value: func(r *Row) (interface{}, bool) { return r.P.X, true }},
+	{name: "ServerLoad", kind: floatKind, parameter: true, value: func(r *Row) (interface{}, bool) { return r.P.ServerLoad, true }},
+	{name: "L", kind: intKind, parameter: true, value: func(r *Row) (interface{}, bool) { return int64(r.P.L), true }},
+	{name: "T", kind: intKind, parameter: true, value: func(r *Row) (interface{}, bool) { return int64(r.P.T), true }},
+	{name: "BruiseThreshold", kind: intKind, parameter: true, value: func(r *Row) (interface{}, bool) { return int64(r.P.BruiseThreshold), true }},
+	{name: "Adversary", kind: stringKind, parameter: true, value: func(r *Row) (interface{}, bool) { return orDefault(r.P.Adversary, "default"), true }},
+	{name: "Epochs", kind: intKind, parameter: true, value: func(r *Row) (interface{}, bool) { return int64(utils.Max(r.P.Epochs, 1)), true }},
+	{name: "Pattern", kind: stringKind, parameter: true, value: func(r *Row) (interface{}, bool) { return orDefault(r.P.Pattern, "permutation"), true }},
+	{name: "XClients", kind: floatKind, parameter: true, value: func(r *Row) (interface{}, bool) { return r.P.XClients, true }},
+	{name: "CorruptedClients", kind: stringKind, value: func(r *Row) (interface{}, bool) { return jsonList(r.P.CorruptedClients) }},
+	{name: "Topology", kind: stringKind, parameter: true, value: func(r *Row) (interface{}, bool) { return orDefault(r.P.Topology, "free"), true }},
+	{name: "RelayWeights", kind: stringKind, value: func(r *Row) (interface{}, bool) { return jsonList(r.P.RelayWeights) }},
+	{name: "Trial", kind: intKind, value: func(r *Row) (interface{}, bool) { return int64(r.Index), true }},
+	{name: "Seed", kind: intKind, value: func(r *Row) (interface{}, bool) { return r.Seed, r.hasSeed }},
+	{name: "Pr0", kind: floatKind, value: func(r *Row) (interface{}, bool) { return r.Pr0, true }},
+	{name: "Pr1", kind: floatKind, value: func(r *Row) (interface{}, bool) { return r.Pr1, true }},
+	{name: "Ratio", kind: floatKind, value: func(r *Row) (interface{}, bool) { return r.Ratio, true }},
+	{name: "Aborted", kind: intKind, value: func(r *Row) (interface{}, bool) { return int64(r.Aborted), true }},
+	{name: "RoundRatios", kind: stringKind, value: func(r *Row) (interface{}, bool) { return jsonList(r.RoundRatios) }},
+	{name: "EpochRatios", kind: stringKind, value: func(r *Row) (interface{}, bool) { return jsonList(r.EpochRatios) }},
+	{name: "Pr0S1", kind: floatKind, value: func(r *Row) (interface{}, bool) { return r.Scenario1.Pr0, r.hasScenario1 }},
+	{name: "Pr1S1", kind: floatKind, value: func(r *Row) (interface{}, bool) { return r.Scenario1.Pr1, r.hasScenario1 }},
+	{name: "RatioS1", kind: floatKind, value: func(r *Row) (interface{}, bool) { return r.Scenario1.Ratio, r.hasScenario1 }},
+	{name: "AbortedS1", kind: intKind, value: func(r *Row) (interface{}, bool) { return int64(r.Scenario1.Aborted), r.hasScenario1 }},
+	{name: "RoundRatiosS1", kind: stringKind, value: func(r *Row) (interface{}, bool) { return jsonList(r.Scenario1.RoundRatios) }},
+	{name: "EpochRatiosS1", kind: stringKind, value: func(r *Row) (interface{}, bool) { return jsonList(r.Scenario1.EpochRatios) }},
+}
+
+func orDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// jsonList returns list as a JSON array, or false if it is empty.
+func jsonList[T any](list []T) (interface{}, bool) {
+	if len(list) == 0 {
+		return "", false
+	}
+	content, err := json.Marshal(list)
+	if err != nil {
+		return "", false
+	}
+	return string(content), true
+}
+
+// format returns the text of a value of the given kind.
+func format(k kind, value interface{}) string {
+	switch k {
+	case intKind:
+		return strconv.FormatInt(value.(int64), 10)
+	case floatKind:
+		return strconv.FormatFloat(value.(float64), 'g', -1, 64)
+	default:
+		return value.(string)
+	}
+}
@@ -0,0 +1,230 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"math"
+	"testing"
+)
+
+func testResults() map[string]data.Result {
+	p1 := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+	p2 := data.Parameters{C: 100, R: 10, X: 0.4, ServerLoad: 10, L: 3, Adversary: "adaptive"}
+	results := make(map[string]data.Result)
+	results[p1.Key()] = data.Result{
+		P:         p1,
+		View:      data.View{Pr0: []float64{0.5, 0.25}, Pr1: []float64{0.25, 0.25}, Ratios: []float64{2, 1}, RoundRatios: [][]float64{{1, 2}, {1, 1}}},
+		Seeds:     []int64{7, 8},
+		Scenario1: data.View{Pr0: []float64{0.25, 0.5}, Pr1: []float64{0.5, 0.5}, Ratios: []float64{0.5, 1}},
+	}
+	// recorded before both scenarios and seeds were
+	results[p2.Key()] = data.Result{
+		P:    p2,
+		View: data.View{Pr0: []float64{0.1}, Pr1: []float64{0.2}, Ratios: []float64{0.5}},
+	}
+	return results
+}
+
+func TestParseFilter(t *testing.T) {
+	results := testResults()
+	for spec, expected := range map[string]int{
+		"":                        3,
+		"C=20":                    2,
+		"C=50..":                  1,
+		"X=..0.3,L=1..3":          2,
+		"Adversary=adaptive":      1,
+		"Adversary=default,R=10":  0,
+		"ServerLoad=10..10,C=..1": 0,
+	} {
+		filter, err := ParseFilter(spec)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if rows := Rows(results, filter); len(rows) != expected {
+			t.Fatalf("Expected %d rows for %q, got %d", expected, spec, len(rows))
+		}
+	}
+
+	for _, spec := range []string{"Ratio=1", "C", "C=a..b", "C=1,C=2"} {
+		if _, err := ParseFilter(spec); err == nil {
+			t.Fatalf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestWrite_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "csv", Rows(testResults(), nil)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(records) != 4 || len(records[0]) != len(columns) {
+		t.Fatalf("Expected a header and 3 rows of %d columns, got %v", len(columns), records)
+	}
+	get := func(row int, name string) string {
+		for j, c := range Columns() {
+			if c == name {
+				return records[row][j]
+			}
+		}
+		t.Fatalf("No column %s", name)
+		return ""
+	}
+	if get(1, "Adversary") != "adaptive" || get(1, "Seed") != "" || get(1, "RatioS1") != "" {
+		t.Fatalf("Unexpected first row %v", records[1])
+	}
+	if get(3, "Seed") != "8" || get(3, "RatioS1") != "1" || get(3, "RoundRatios") != "[1,1]" || get(3, "X") != "0.2" {
+		t.Fatalf("Unexpected last row %v", records[3])
+	}
+}
+
+func TestWrite_Parquet(t *testing.T) {
+	defer func(rowGroupRows, pageSize int) {
+		parquetRowGroupRows, parquetPageSize = rowGroupRows, pageSize
+	}(parquetRowGroupRows, parquetPageSize)
+
+	rows := Rows(testResults(), nil)
+	for _, limits := range [][2]int{{parquetRowGroupRows, parquetPageSize}, {2, 1}} {
+		// {2, 1} writes 2 row groups, with a page per value
+		parquetRowGroupRows, parquetPageSize = limits[0], limits[1]
+		var buf bytes.Buffer
+		if err := Write(&buf, "parquet", rows); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		file := buf.Bytes()
+		if string(file[:4]) != parquetMagic || string(file[len(file)-4:]) != parquetMagic {
+			t.Fatalf("Missing magic number")
+		}
+		footerLength := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+		metadata, _ := readThriftStruct(t, file[len(file)-8-footerLength:len(file)-8])
+
+		if metadata[3].(int64) != int64(len(rows)) {
+			t.Fatalf("Expected %d rows, got %d", len(rows), metadata[3])
+		}
+		schema := metadata[2].([]interface{})
+		if len(schema) != len(columns)+1 {
+			t.Fatalf("Expected %d schema elements, got %d", len(columns)+1, len(schema))
+		}
+		rowGroups := metadata[4].([]interface{})
+		if expected := (len(rows) + limits[0] - 1) / limits[0]; len(rowGroups) != expected {
+			t.Fatalf("Expected %d row groups, got %d", expected, len(rowGroups))
+		}
+
+		// read back the pages of a column in every row group, returning the definition levels and the values
+		readColumn := func(name string) (present []bool, values []byte) {
+			i := 0
+			for ; i < len(columns) && columns[i].name != name; i++ {
+			}
+			if i == len(columns) {
+				t.Fatalf("No column %s", name)
+			}
+			if element := schema[i+1].(map[int16]interface{}); string(element[4].([]byte)) != name {
+				t.Fatalf("Expected schema element %s, got %s", name, element[4])
+			}
+			for _, rowGroup := range rowGroups {
+				chunk := rowGroup.(map[int16]interface{})[1].([]interface{})[i]
+				meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+				offset, end := meta[9].(int64), meta[9].(int64)+meta[7].(int64)
+				numValues := 0
+				for offset < end {
+					header, n := readThriftStruct(t, file[offset:])
+					page := file[offset+int64(n) : offset+int64(n)+header[3].(int64)]
+					numValues += int(header[5].(map[int16]interface{})[1].(int64))
+					levelsLength := binary.LittleEndian.Uint32(page)
+					levels := page[4 : 4+levelsLength]
+					for len(levels) > 0 {
+						run, m := binary.Uvarint(levels)
+						for j := 0; j < int(run>>1); j++ {
+							present = append(present, levels[m] == 1)
+						}
+						levels = levels[m+1:]
+					}
+					values = append(values, page[4+levelsLength:]...)
+					offset += int64(n) + header[3].(int64)
+				}
+				if numValues != int(meta[5].(int64)) {
+					t.Fatalf("Expected %d values in the pages of %s, got %d", meta[5], name, numValues)
+				}
+			}
+			return present, values
+		}
+
+		present, values := readColumn("Ratio")
+		for i, row := range rows {
+			if !present[i] || math.Float64frombits(binary.LittleEndian.Uint64(values[8*i:])) != row.Ratio {
+				t.Fatalf("Row %d: expected ratio %f", i, row.Ratio)
+			}
+		}
+		present, values = readColumn("RatioS1")
+		if present[0] || !present[1] || !present[2] || len(values) != 16 || math.Float64frombits(binary.LittleEndian.Uint64(values[8:])) != 1 {
+			t.Fatalf("Unexpected RatioS1 column: %v %v", present, values)
+		}
+		present, values = readColumn("Adversary")
+		if len(present) != 3 || binary.LittleEndian.Uint32(values) != 8 || string(values[4:12]) != "adaptive" {
+			t.Fatalf("Unexpected Adversary column: %v %q", present, values)
+		}
+	}
+}
+
+func TestWriteThriftStruct_RejectsUnsupportedValue(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeThriftStruct(&buf, thriftStruct{{1, thriftStruct{{1, 1.5}}}}); err == nil {
+		t.Fatalf("Expected an error for a float field")
+	}
+	if err := writeThriftStruct(&buf, thriftStruct{{1, []int64{1}}}); err == nil {
+		t.Fatalf("Expected an error for a list of int64")
+	}
+}
+
+// readThriftStruct decodes a Thrift struct in the compact protocol into a map from field id to value (an int64,
+// []byte, list or nested map), and returns the number of bytes it took.
+func readThriftStruct(t *testing.T, b []byte) (map[int16]interface{}, int) {
+	fields := make(map[int16]interface{})
+	pos, lastId := 0, int16(0)
+	for {
+		header := b[pos]
+		pos++
+		if header == 0 {
+			return fields, pos
+		}
+		id := lastId + int16(header>>4)
+		if header>>4 == 0 {
+			v, n := binary.Varint(b[pos:])
+			id, pos = int16(v), pos+n
+		}
+		value, n := readThriftValue(t, header&0x0f, b[pos:])
+		fields[id], pos, lastId = value, pos+n, id
+	}
+}
+
+func readThriftValue(t *testing.T, typeId byte, b []byte) (interface{}, int) {
+	switch typeId {
+	case thriftTypeI32, thriftTypeI64:
+		return binary.Varint(b)
+	case thriftTypeBinary:
+		length, n := binary.Uvarint(b)
+		return b[n : n+int(length)], n + int(length)
+	case thriftTypeStruct:
+		return readThriftStruct(t, b)
+	case thriftTypeList:
+		size, elementType, pos := int(b[0]>>4), b[0]&0x0f, 1
+		if size == 15 {
+			s, n := binary.Uvarint(b[1:])
+			size, pos = int(s), pos+n
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			value, n := readThriftValue(t, elementType, b[pos:])
+			list[i], pos = value, pos+n
+		}
+		return list, pos
+	default:
+		t.Fatalf("Unexpected Thrift type %d", typeId)
+		return nil, 0
+	}
+}
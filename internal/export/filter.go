@@ -0,0 +1,123 @@
+package export
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter selects results by their parameters. Every condition must hold for a result to match.
+type Filter struct {
+	conditions []condition
+}
+
+// condition restricts the value of a parameter column: numbers to the range [min, max], strings to value.
+type condition struct {
+	column   column
+	min, max float64
+	value    string
+}
+
+// NewFilter returns the filter with a condition for every parameter in conditions (see ParseFilter for the syntax of
+// a condition).
+func NewFilter(conditions map[string]string) (*Filter, error) {
+	names := utils.GetKeys(conditions)
+	sort.Strings(names)
+	f := &Filter{}
+	for _, name := range names {
+		c, err := newCondition(name, conditions[name])
+		if err != nil {
+			return nil, err
+		}
+		f.conditions = append(f.conditions, c)
+	}
+	return f, nil
+}
+
+// ParseFilter parses a comma-separated list of conditions on parameters, each of the form name=value. The value of a
+// numeric parameter is a number or an inclusive range min..max, either end of which may be left out (e.g.
+// "C=100..1000,X=..0.2,L=5,Adversary=adaptive"). "" matches every result.
+func ParseFilter(spec string) (*Filter, error) {
+	conditions := make(map[string]string)
+	if spec != "" {
+		for _, term := range strings.Split(spec, ",") {
+			name, value, found := strings.Cut(strings.TrimSpace(term), "=")
+			if !found {
+				return nil, pl.NewError("invalid condition %q (expected name=value)", term)
+			}
+			if _, present := conditions[name]; present {
+				return nil, pl.NewError("more than one condition on %s", name)
+			}
+			conditions[name] = value
+		}
+	}
+	return NewFilter(conditions)
+}
+
+func newCondition(name, value string) (condition, error) {
+	for _, column := range columns {
+		if column.parameter && column.name == name {
+			c := condition{column: column, value: value}
+			if column.kind == stringKind {
+				return c, nil
+			}
+			var err error
+			low, high, isRange := strings.Cut(value, "..")
+			if !isRange {
+				high = low
+			}
+			if c.min, err = parseBound(low, math.Inf(-1)); err != nil {
+				return c, pl.WrapError(err, "invalid condition on %s", name)
+			}
+			if c.max, err = parseBound(high, math.Inf(1)); err != nil {
+				return c, pl.WrapError(err, "invalid condition on %s", name)
+			}
+			return c, nil
+		}
+	}
+	parameters := utils.Map(utils.Filter(columns, func(c column) bool {
+		return c.parameter
+	}), func(c column) string {
+		return c.name
+	})
+	return condition{}, pl.NewError("cannot filter by %q (expected one of %v)", name, parameters)
+}
+
+// parseBound parses a bound of a range, returning open if it is left out.
+func parseBound(bound string, open float64) (float64, error) {
+	if bound == "" {
+		return open, nil
+	}
+	value, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return 0, pl.NewError("invalid number %q", bound)
+	}
+	return value, nil
+}
+
+// Matches reports whether p satisfies every condition of f.
+func (f *Filter) Matches(p data.Parameters) bool {
+	row := &Row{P: p}
+	for _, c := range f.conditions {
+		value, _ := c.column.value(row)
+		switch c.column.kind {
+		case intKind:
+			if x := float64(value.(int64)); x < c.min || x > c.max {
+				return false
+			}
+		case floatKind:
+			if x := value.(float64); x < c.min || x > c.max {
+				return false
+			}
+		default:
+			if value.(string) != c.value {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,341 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"io"
+	"math"
+)
+
+// The Parquet file format (https://parquet.apache.org/docs/file-format/) is simple enough to write directly: after the
+// magic number, every column chunk of every row group is a sequence of page headers each followed by its page, and the
+// file ends with the file metadata, its length and the magic number again. Headers and metadata are Thrift structs in
+// the compact protocol.
+
+const parquetMagic = "PAR1"
+
+// Parquet physical types, encodings and other enum values (see parquet.thrift).
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1 // field repetition type
+	parquetUTF8     = 0 // converted type
+	parquetPlain    = 0 // encoding
+	parquetRLE      = 3 // encoding
+	parquetDataPage = 0 // page type
+)
+
+// parquetTypes maps the kind of a column to its Parquet physical type.
+var parquetTypes = map[kind]int32{
+	intKind:    parquetInt64,
+	floatKind:  parquetDouble,
+	stringKind: parquetByteArray,
+}
+
+// parquetRowGroupRows bounds the rows of a row group, which readers load a column at a time, and parquetPageSize bounds
+// the values of a data page (a page holds at least one value), whose size is an int32.
+var (
+	parquetRowGroupRows = 1 << 20
+	parquetPageSize     = 1 << 20
+)
+
+// writeParquet writes rows as a Parquet file of uncompressed, PLAIN-encoded data pages, in row groups of at most
+// parquetRowGroupRows rows. Every column is optional, so that missing values are null.
+func writeParquet(w io.Writer, rows []Row) error {
+	out := &countingWriter{w: w}
+	if _, err := io.WriteString(out, parquetMagic); err != nil {
+		return pl.WrapError(err, "failed to write Parquet header")
+	}
+
+	rowGroups := make([]thriftStruct, 0)
+	for start := 0; start < len(rows); start += parquetRowGroupRows {
+		group := rows[start:utils.Min(start+parquetRowGroupRows, len(rows))]
+		chunks := make([]thriftStruct, 0, len(columns))
+		totalSize := int64(0)
+		for _, c := range columns {
+			offset := out.n
+			if err := writeParquetColumn(out, c, group); err != nil {
+				return pl.WrapError(err, "failed to write column %s", c.name)
+			}
+			size := out.n - offset
+			totalSize += size
+			chunks = append(chunks, thriftStruct{
+				{2, offset},
+				{3, thriftStruct{
+					{1, parquetTypes[c.kind]},
+					{2, []int32{parquetPlain, parquetRLE}},
+					{3, []string{c.name}},
+					{4, int32(0)}, // uncompressed
+					{5, int64(len(group))},
+					{6, size},
+					{7, size},
+					{9, offset},
+				}},
+			})
+		}
+		rowGroups = append(rowGroups, thriftStruct{
+			{1, chunks},
+			{2, totalSize},
+			{3, int64(len(group))},
+		})
+	}
+
+	schema := []thriftStruct{{
+		{4, "schema"},
+		{5, int32(len(columns))},
+	}}
+	for _, c := range columns {
+		element := thriftStruct{
+			{1, parquetTypes[c.kind]},
+			{3, int32(parquetOptional)},
+			{4, c.name},
+		}
+		if c.kind == stringKind {
+			element = append(element, thriftField{6, int32(parquetUTF8)})
+		}
+		schema = append(schema, element)
+	}
+
+	var footer bytes.Buffer
+	if err := writeThriftStruct(&footer, thriftStruct{
+		{1, int32(1)},
+		{2, schema},
+		{3, int64(len(rows))},
+		{4, rowGroups},
+		{6, "pi_t-privacy-evaluation"},
+	}); err != nil {
+		return pl.WrapError(err, "failed to encode Parquet footer")
+	}
+	if err := binary.Write(&footer, binary.LittleEndian, uint32(footer.Len())); err != nil {
+		return pl.WrapError(err, "failed to write Parquet footer")
+	}
+	footer.WriteString(parquetMagic)
+	if _, err := out.Write(footer.Bytes()); err != nil {
+		return pl.WrapError(err, "failed to write Parquet footer")
+	}
+	return nil
+}
+
+// writeParquetColumn writes the column chunk of column c, as data pages of about parquetPageSize bytes of values.
+func writeParquetColumn(w io.Writer, c column, rows []Row) error {
+	var page parquetPage
+	for i := range rows {
+		value, present := c.value(&rows[i])
+		page.add(c.kind, value, present)
+		if page.values.Len() >= parquetPageSize {
+			if err := page.write(w); err != nil {
+				return err
+			}
+		}
+	}
+	if page.numValues > 0 {
+		return page.write(w)
+	}
+	return nil
+}
+
+// parquetPage is a data page being encoded: the definition level of every row (1 if it has a value, 0 if it is null)
+// followed by the values of the rows that have one.
+type parquetPage struct {
+	levels, values bytes.Buffer
+	numValues      int // rows, including nulls
+	run            bool
+	runLength      int
+}
+
+func (p *parquetPage) add(k kind, value interface{}, present bool) {
+	if present != p.run {
+		p.flushRun()
+		p.run, p.runLength = present, 0
+	}
+	p.runLength++
+	p.numValues++
+	if !present {
+		return
+	}
+	switch k {
+	case intKind:
+		_ = binary.Write(&p.values, binary.LittleEndian, value.(int64))
+	case floatKind:
+		_ = binary.Write(&p.values, binary.LittleEndian, math.Float64bits(value.(float64)))
+	default:
+		_ = binary.Write(&p.values, binary.LittleEndian, uint32(len(value.(string))))
+		p.values.WriteString(value.(string))
+	}
+}
+
+// flushRun encodes the current run of definition levels, as a run of the RLE/bit-packing hybrid encoding with bit
+// width 1.
+func (p *parquetPage) flushRun() {
+	if p.runLength > 0 {
+		writeUvarint(&p.levels, uint64(p.runLength)<<1)
+		if p.run {
+			p.levels.WriteByte(1)
+		} else {
+			p.levels.WriteByte(0)
+		}
+	}
+}
+
+// write writes the page header and the page to w, and resets p for the next page.
+func (p *parquetPage) write(w io.Writer) error {
+	p.flushRun()
+	size := 4 + p.levels.Len() + p.values.Len()
+	if size > math.MaxInt32 {
+		return pl.NewError("data page of %d bytes exceeds the Parquet limit", size)
+	}
+
+	var header bytes.Buffer
+	if err := writeThriftStruct(&header, thriftStruct{
+		{1, int32(parquetDataPage)},
+		{2, int32(size)},
+		{3, int32(size)},
+		{5, thriftStruct{
+			{1, int32(p.numValues)},
+			{2, int32(parquetPlain)},
+			{3, int32(parquetRLE)},
+			{4, int32(parquetRLE)},
+		}},
+	}); err != nil {
+		return pl.WrapError(err, "failed to encode page header")
+	}
+	_ = binary.Write(&header, binary.LittleEndian, uint32(p.levels.Len()))
+
+	for _, b := range [][]byte{header.Bytes(), p.levels.Bytes(), p.values.Bytes()} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	*p = parquetPage{}
+	return nil
+}
+
+// countingWriter counts the bytes written to w, which gives the offsets of the column chunks.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// thriftStruct is a Thrift struct, as its fields in increasing order of id.
+type thriftStruct []thriftField
+
+// thriftField is a field of a Thrift struct. Its value is an int32, int64, string, thriftStruct, or a list of int32,
+// string or thriftStruct.
+type thriftField struct {
+	id    int16
+	value interface{}
+}
+
+// Thrift compact protocol type ids.
+const (
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeStruct = 12
+)
+
+// writeThriftStruct encodes s with the Thrift compact protocol.
+func writeThriftStruct(buf *bytes.Buffer, s thriftStruct) error {
+	lastId := int16(0)
+	for _, f := range s {
+		typeId, err := thriftType(f.value)
+		if err != nil {
+			return pl.WrapError(err, "failed to encode Thrift field %d", f.id)
+		}
+		if delta := f.id - lastId; delta > 0 && delta <= 15 {
+			buf.WriteByte(byte(delta)<<4 | typeId)
+		} else {
+			buf.WriteByte(typeId)
+			writeUvarint(buf, zigzag(int64(f.id)))
+		}
+		lastId = f.id
+		if err = writeThriftValue(buf, f.value); err != nil {
+			return pl.WrapError(err, "failed to encode Thrift field %d", f.id)
+		}
+	}
+	buf.WriteByte(0) // stop
+	return nil
+}
+
+// thriftType returns the compact protocol type id of value.
+func thriftType(value interface{}) (byte, error) {
+	switch value.(type) {
+	case int32:
+		return thriftTypeI32, nil
+	case int64:
+		return thriftTypeI64, nil
+	case string:
+		return thriftTypeBinary, nil
+	case thriftStruct:
+		return thriftTypeStruct, nil
+	case []int32, []string, []thriftStruct:
+		return thriftTypeList, nil
+	default:
+		return 0, pl.NewError("unsupported Thrift value %v", value)
+	}
+}
+
+// writeThriftValue encodes value, without its type id.
+func writeThriftValue(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case int32:
+		writeUvarint(buf, zigzag(int64(v)))
+	case int64:
+		writeUvarint(buf, zigzag(v))
+	case string:
+		writeUvarint(buf, uint64(len(v)))
+		buf.WriteString(v)
+	case thriftStruct:
+		return writeThriftStruct(buf, v)
+	case []int32:
+		return writeThriftList(buf, v)
+	case []string:
+		return writeThriftList(buf, v)
+	case []thriftStruct:
+		return writeThriftList(buf, v)
+	default:
+		return pl.NewError("unsupported Thrift value %v", value)
+	}
+	return nil
+}
+
+// writeThriftList encodes a list whose elements all have the same type.
+func writeThriftList[T any](buf *bytes.Buffer, list []T) error {
+	var zero T
+	typeId, err := thriftType(zero)
+	if err != nil {
+		return err
+	}
+	if len(list) < 15 {
+		buf.WriteByte(byte(len(list))<<4 | typeId)
+	} else {
+		buf.WriteByte(0xf0 | typeId)
+		writeUvarint(buf, uint64(len(list)))
+	}
+	for _, element := range list {
+		if err = writeThriftValue(buf, element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func zigzag(n int64) uint64 {
+	return uint64(n<<1) ^ uint64(n>>63)
+}
+
+func writeUvarint(buf *bytes.Buffer, n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], n)])
+}
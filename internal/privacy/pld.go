@@ -0,0 +1,178 @@
+package privacy
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"gonum.org/v1/gonum/dsp/fourier"
+	"math"
+)
+
+// DefaultStep is the default discretization of privacy losses.
+const DefaultStep = 1e-3
+
+// PLD is a privacy loss distribution discretized to multiples of Step: Mass[i] is the probability that the privacy
+// loss is (Offset+i)·Step.
+type PLD struct {
+	Step   float64
+	Offset int
+	Mass   []float64
+}
+
+// NewPLD returns the empirical distribution of the given privacy losses, each rounded up to a multiple of step so
+// that the δ computed from the PLD never underestimates the δ of the losses themselves.
+func NewPLD(losses []float64, step float64) *PLD {
+	if len(losses) == 0 {
+		return &PLD{Step: step, Mass: []float64{1}}
+	}
+	indices := utils.Map(losses, func(loss float64) int {
+		return int(math.Ceil(loss/step - 1e-9))
+	})
+	low, high := utils.MinOver(indices), utils.MaxOver(indices)
+	p := &PLD{
+		Step:   step,
+		Offset: low,
+		Mass:   make([]float64, high-low+1),
+	}
+	for _, i := range indices {
+		p.Mass[i-low] += 1.0 / float64(len(losses))
+	}
+	return p
+}
+
+// Compose returns the PLD of the composition of the (independent) mechanisms described by p and q, i.e. the
+// distribution of the sum of their privacy losses.
+func (p *PLD) Compose(q *PLD) *PLD {
+	return &PLD{
+		Step:   p.Step,
+		Offset: p.Offset + q.Offset,
+		Mass:   convolve(p.Mass, q.Mass),
+	}
+}
+
+// ComposeN returns the PLD of k independent runs of the mechanism described by p.
+func (p *PLD) ComposeN(k int) *PLD {
+	result := &PLD{Step: p.Step, Mass: []float64{1}}
+	for square := p; k > 0; k /= 2 {
+		if k%2 == 1 {
+			result = result.Compose(square)
+		}
+		if k > 1 {
+			square = square.Compose(square)
+		}
+	}
+	return result
+}
+
+// Delta returns the smallest δ for which the mechanism is (ϵ, δ)-DP in the direction described by p, i.e.
+// E[max(0, 1 - e^(ϵ-ℓ))] over privacy losses ℓ.
+func (p *PLD) Delta(epsilon float64) float64 {
+	delta := 0.0
+	for i, mass := range p.Mass {
+		if loss := float64(p.Offset+i) * p.Step; loss > epsilon {
+			delta += mass * (1 - math.Exp(epsilon-loss))
+		}
+	}
+	return clamp(delta)
+}
+
+// Epsilon returns the smallest ϵ ≥ 0 for which Delta(ϵ) ≤ delta.
+func (p *PLD) Epsilon(delta float64) float64 {
+	low, high := 0.0, math.Max(float64(p.Offset+len(p.Mass)-1)*p.Step, 0)
+	if p.Delta(low) <= delta {
+		return low
+	}
+	// Delta decreases with ϵ and is 0 at the largest loss
+	for i := 0; i < 100 && high-low > 1e-9; i++ {
+		mid := (low + high) / 2
+		if p.Delta(mid) <= delta {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return high
+}
+
+// Accountant tracks the privacy loss distribution of the target's message over any number of epochs.
+//
+// The privacy loss of an epoch is the log of the adversary's final ratio (clamped to [1/MaxRatio, MaxRatio]), in both
+// directions (Scenario 0 against 1, and 1 against 0) when both scenarios were recorded, and its PLD is the empirical
+// distribution of those losses over the trials. Epochs use fresh paths and are composed as independent mechanisms.
+type Accountant struct {
+	directions []*PLD
+}
+
+// NewAccountant returns an Accountant for a single epoch of the trials of r.
+func NewAccountant(r data.Result, step float64) *Accountant {
+	a := &Accountant{
+		directions: []*PLD{NewPLD(utils.Map(r.Ratios, logRatio), step)},
+	}
+	if r.HasBothScenarios() {
+		a.directions = append(a.directions, NewPLD(utils.Map(utils.Map(r.Scenario1.Ratios, logRatio), negate), step))
+	}
+	return a
+}
+
+// Epochs returns the Accountant for k epochs of the mechanism tracked by a.
+func (a *Accountant) Epochs(k int) *Accountant {
+	return &Accountant{
+		directions: utils.Map(a.directions, func(p *PLD) *PLD {
+			return p.ComposeN(k)
+		}),
+	}
+}
+
+// Delta returns the δ at the given ϵ (the larger of both directions).
+func (a *Accountant) Delta(epsilon float64) float64 {
+	delta := 0.0
+	for _, p := range a.directions {
+		delta = math.Max(delta, p.Delta(epsilon))
+	}
+	return delta
+}
+
+// Epsilon returns the smallest ϵ for which δ ≤ delta in both directions.
+func (a *Accountant) Epsilon(delta float64) float64 {
+	epsilon := 0.0
+	for _, p := range a.directions {
+		epsilon = math.Max(epsilon, p.Epsilon(delta))
+	}
+	return epsilon
+}
+
+// convolve returns the convolution of a and b, directly for short inputs and with an FFT otherwise.
+func convolve(a, b []float64) []float64 {
+	n := len(a) + len(b) - 1
+	if len(a)*len(b) <= 1<<16 {
+		result := make([]float64, n)
+		for i, x := range a {
+			for j, y := range b {
+				result[i+j] += x * y
+			}
+		}
+		return result
+	}
+
+	size := 1
+	for size < n {
+		size *= 2
+	}
+	fft := fourier.NewFFT(size)
+	coefficientsA := fft.Coefficients(nil, pad(a, size))
+	coefficientsB := fft.Coefficients(nil, pad(b, size))
+	for i := range coefficientsA {
+		coefficientsA[i] *= coefficientsB[i]
+	}
+	result := fft.Sequence(nil, coefficientsA)[:n]
+	for i := range result {
+		// undo the scaling of the unnormalized transform, and drop the rounding noise around 0
+		result[i] = math.Max(result[i]/float64(size), 0)
+	}
+	return result
+}
+
+func pad(values []float64, size int) []float64 {
+	padded := make([]float64, size)
+	copy(padded, values)
+	return padded
+}
@@ -0,0 +1,74 @@
+package privacy
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"gonum.org/v1/gonum/stat/distuv"
+	"math"
+	"testing"
+)
+
+// gaussianPLD returns the discretized PLD of the Gaussian mechanism with sensitivity/σ = mu, whose privacy loss is
+// distributed as N(mu²/2, mu²).
+func gaussianPLD(mu, step float64) *PLD {
+	loss := distuv.Normal{Mu: mu * mu / 2, Sigma: mu}
+	low, high := int(math.Floor((loss.Mu-10*mu)/step)), int(math.Ceil((loss.Mu+10*mu)/step))
+	p := &PLD{Step: step, Offset: low, Mass: make([]float64, high-low+1)}
+	for i := range p.Mass {
+		x := float64(low+i) * step
+		p.Mass[i] = loss.CDF(x) - loss.CDF(x-step)
+	}
+	return p
+}
+
+// gaussianDelta returns the exact δ(ϵ) of the Gaussian mechanism with sensitivity/σ = mu.
+func gaussianDelta(mu, epsilon float64) float64 {
+	std := distuv.UnitNormal
+	return std.CDF(-epsilon/mu+mu/2) - math.Exp(epsilon)*std.CDF(-epsilon/mu-mu/2)
+}
+
+func TestPLD_ComposesGaussianMechanism(t *testing.T) {
+	mu, k := 0.5, 16
+	composed := gaussianPLD(mu, 1e-3).ComposeN(k)
+	for _, epsilon := range []float64{0.5, 1, 2, 4} {
+		expected := gaussianDelta(mu*math.Sqrt(float64(k)), epsilon)
+		// rounding losses up to the grid may only overestimate δ, by about k·step/2 worth of loss
+		if got := composed.Delta(epsilon); got < expected-1e-9 || got > expected+5e-3 {
+			t.Fatalf("ϵ=%f: expected δ=%f after %d compositions, got %f", epsilon, expected, k, got)
+		}
+	}
+}
+
+func TestPLD_Epsilon(t *testing.T) {
+	// a single loss of 2 gives δ(ϵ) = 1 - e^(ϵ-2)
+	p := NewPLD([]float64{2}, DefaultStep)
+	delta := 0.5
+	if epsilon := p.Epsilon(delta); math.Abs(epsilon-(2+math.Log(1-delta))) > 1e-6 {
+		t.Fatalf("Expected ϵ=%f, got %f", 2+math.Log(1-delta), epsilon)
+	}
+}
+
+func TestAccountant_ComposesFinalLossOverEpochs(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 20, L: 3}
+	r, err := simulation.Run(p, 50, 1, 0)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	a := NewAccountant(*r, DefaultStep)
+	final := NewPLD(utils.Map(r.Ratios, logRatio), DefaultStep)
+	for _, epsilon := range []float64{0, 0.5, 1} {
+		if a.Delta(epsilon) < final.Delta(epsilon) {
+			t.Fatalf("ϵ=%f: expected δ to be at least %f, the δ of the final losses, got %f", epsilon, final.Delta(epsilon), a.Delta(epsilon))
+		}
+		if composed := final.ComposeN(4).Delta(epsilon); a.Epochs(4).Delta(epsilon) < composed {
+			t.Fatalf("ϵ=%f: expected δ after 4 epochs to be at least %f, got %f", epsilon, composed, a.Epochs(4).Delta(epsilon))
+		}
+	}
+	for _, delta := range []float64{0.5, 0.1} {
+		if a.Epochs(4).Epsilon(delta) < a.Epsilon(delta) {
+			t.Fatalf("δ=%f: expected ϵ not to decrease over epochs", delta)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package privacy
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"gonum.org/v1/gonum/stat/distuv"
+	"math"
+	"sort"
+)
+
+// MaxRatio is the largest ratio the adversary reports (see rounds.Rounds.GetRatio); ratios are clamped to
+// [1/MaxRatio, MaxRatio].
+const MaxRatio = 1000.0
+
+// Point is an estimate of the δ for which the adversary's views satisfy (ϵ, δ)-DP, along with confidence bounds on it.
+type Point struct {
+	Epsilon float64
+	Delta   float64 // point estimate of δ
+	Lower   float64 // lower confidence bound on δ
+	Upper   float64 // upper confidence bound on δ
+}
+
+// Estimator estimates the (ϵ, δ) trade-off of a set of trials.
+//
+// With both scenarios recorded, δ(ϵ) is estimated as the larger of Pr_0[V] - e^ϵ·Pr_1[V] and Pr_1[V'] - e^ϵ·Pr_0[V'],
+// where Pr_i is the distribution of the adversary's ratio in Scenario i, V is the set of views whose ratio exceeds
+// e^ϵ and V' is the set of views whose ratio is below e^-ϵ (the sets a likelihood-ratio test would pick). As V and V'
+// don't depend on the sampled views, each probability is a binomial proportion, and δ is bounded by combining
+// Clopper–Pearson intervals on the four proportions. Each interval has confidence 1 - (1 - c)/2, so that by the
+// union bound both the upper and the lower bound on δ hold with confidence c.
+//
+// The confidence is pointwise: the bounds on δ at any one ϵ hold with confidence c, but not simultaneously at every
+// ϵ. Epsilon and EpsilonInterval scan ϵ for where the bounds cross the target δ, so their confidence is that of the
+// bounds at the ϵ they return, not a guarantee over the scan.
+//
+// For results recorded before both scenarios were simulated, δ(ϵ) is the fraction of trials whose ratio exceeds e^ϵ.
+type Estimator struct {
+	Confidence float64 // e.g. 0.95
+
+	directions []direction
+}
+
+// direction holds the sorted log ratios of the two distributions compared in one direction, oriented so that the
+// distinguishing set of views is {log ratio > ϵ}. q is empty if only one scenario was recorded.
+type direction struct {
+	p, q []float64
+}
+
+// NewEstimator returns an Estimator over the trials of r.
+func NewEstimator(r data.Result, confidence float64) *Estimator {
+	logRatios0 := utils.Map(r.Ratios, logRatio)
+	e := &Estimator{Confidence: confidence}
+	if r.HasBothScenarios() {
+		logRatios1 := utils.Map(r.Scenario1.Ratios, logRatio)
+		e.directions = []direction{
+			newDirection(logRatios0, logRatios1),
+			newDirection(utils.Map(logRatios1, negate), utils.Map(logRatios0, negate)),
+		}
+	} else {
+		e.directions = []direction{newDirection(logRatios0, nil)}
+	}
+	return e
+}
+
+func newDirection(p, q []float64) direction {
+	p = utils.Copy(p)
+	q = utils.Copy(q)
+	sort.Float64s(p)
+	sort.Float64s(q)
+	return direction{p: p, q: q}
+}
+
+// Delta estimates δ at the given ϵ.
+func (e *Estimator) Delta(epsilon float64) Point {
+	point := Point{Epsilon: epsilon}
+	for _, d := range e.directions {
+		estimate, lower, upper := d.delta(epsilon, e.Confidence)
+		point.Delta = math.Max(point.Delta, estimate)
+		point.Lower = math.Max(point.Lower, lower)
+		point.Upper = math.Max(point.Upper, upper)
+	}
+	return point
+}
+
+// Curve estimates δ at each of the given values of ϵ.
+func (e *Estimator) Curve(epsilons []float64) []Point {
+	return utils.Map(epsilons, e.Delta)
+}
+
+// Epsilon returns the smallest ϵ such that the upper confidence bound on δ is at most target for ϵ and every larger
+// value, i.e. the smallest ϵ for which (ϵ, target)-DP holds with the estimator's (pointwise) confidence. It returns
+// +Inf if there are too few trials to bound δ by target at any ϵ.
+func (e *Estimator) Epsilon(target float64) float64 {
+	// in between breakpoints, the upper bound on δ decreases with ϵ
+	breakpoints := e.breakpoints()
+
+	// walk the intervals [breakpoints[i], breakpoints[i+1]) from the top down for as long as they are feasible
+	epsilon := math.Inf(1)
+	for i := len(breakpoints) - 1; i >= 0; i-- {
+		start, end := breakpoints[i], math.Inf(1)
+		if i+1 < len(breakpoints) {
+			end = breakpoints[i+1]
+		}
+		from := start
+		for _, d := range e.directions {
+			from = math.Max(from, d.feasibleFrom(start, target, e.Confidence))
+		}
+		if from >= end {
+			break
+		}
+		epsilon = from
+		if from > start {
+			break
+		}
+	}
+	return epsilon
+}
+
+// EpsilonInterval returns a confidence interval on the smallest ϵ for which (ϵ, target)-DP holds. The upper end is
+// Epsilon(target), and the lower end is the largest ϵ at which the lower confidence bound on δ still exceeds target (0
+// if there is none), below which (ϵ, target)-DP is ruled out with the estimator's (pointwise) confidence.
+func (e *Estimator) EpsilonInterval(target float64) (lower, upper float64) {
+	upper = e.Epsilon(target)
+
+	// in between breakpoints, the lower bound on δ decreases with ϵ, so the highest interval in which it exceeds
+	// target holds the lower end
+	breakpoints := e.breakpoints()
+	for i := len(breakpoints) - 1; i >= 0; i-- {
+		start, end := breakpoints[i], math.Inf(1)
+		if i+1 < len(breakpoints) {
+			end = breakpoints[i+1]
+		}
+		found := false
+		for _, d := range e.directions {
+			if until, infeasible := d.infeasibleUntil(start, end, target, e.Confidence); infeasible {
+				lower = math.Max(lower, until)
+				found = true
+			}
+		}
+		if found {
+			break
+		}
+	}
+	return math.Min(lower, upper), upper
+}
+
+// breakpoints returns the values of ϵ, in increasing order and starting at 0, at which the proportions change: the
+// absolute values of the observed log ratios.
+func (e *Estimator) breakpoints() []float64 {
+	breakpoints := []float64{0}
+	for _, d := range e.directions {
+		breakpoints = append(append(breakpoints, utils.Map(d.p, math.Abs)...), utils.Map(d.q, math.Abs)...)
+	}
+	sort.Float64s(breakpoints)
+	return utils.RemoveDuplicates(breakpoints)
+}
+
+// counts returns the number of views of p and of q in {log ratio > ϵ}.
+func (d direction) counts(epsilon float64) (int, int) {
+	above := func(values []float64) int {
+		return len(values) - sort.Search(len(values), func(i int) bool {
+			return values[i] > epsilon
+		})
+	}
+	return above(d.p), above(d.q)
+}
+
+// delta returns the estimate and the confidence bounds of Pr_p[V] - e^ϵ·Pr_q[V].
+func (d direction) delta(epsilon, confidence float64) (estimate, lower, upper float64) {
+	kp, kq := d.counts(epsilon)
+	lowerP, upperP := ClopperPearson(kp, len(d.p), d.confidence(confidence))
+	estimate = float64(kp) / float64(len(d.p))
+	lower, upper = lowerP, upperP
+	if len(d.q) > 0 {
+		lowerQ, upperQ := ClopperPearson(kq, len(d.q), d.confidence(confidence))
+		estimate -= math.Exp(epsilon) * float64(kq) / float64(len(d.q))
+		lower -= math.Exp(epsilon) * upperQ
+		upper -= math.Exp(epsilon) * lowerQ
+	}
+	return clamp(estimate), clamp(lower), clamp(upper)
+}
+
+// feasibleFrom returns the smallest ϵ ≥ start, within the interval of ϵ over which the counts are those at start, such
+// that the upper bound on δ is at most target (+Inf if there is none).
+func (d direction) feasibleFrom(start, target, confidence float64) float64 {
+	kp, kq := d.counts(start)
+	_, upperP := ClopperPearson(kp, len(d.p), d.confidence(confidence))
+	if upperP <= target {
+		return start
+	}
+	if len(d.q) == 0 {
+		return math.Inf(1)
+	}
+	lowerQ, _ := ClopperPearson(kq, len(d.q), d.confidence(confidence))
+	if lowerQ == 0 {
+		return math.Inf(1)
+	}
+	// upperP - e^ϵ·lowerQ ≤ target
+	return math.Max(start, math.Log((upperP-target)/lowerQ))
+}
+
+// infeasibleUntil reports whether the lower bound on δ exceeds target at start, where the counts are those of the
+// interval [start, end), and if so, returns the largest ϵ in the interval up to which it does.
+func (d direction) infeasibleUntil(start, end, target, confidence float64) (float64, bool) {
+	kp, kq := d.counts(start)
+	lowerP, _ := ClopperPearson(kp, len(d.p), d.confidence(confidence))
+	upperQ := 0.0
+	if len(d.q) > 0 {
+		_, upperQ = ClopperPearson(kq, len(d.q), d.confidence(confidence))
+	}
+	if lowerP-math.Exp(start)*upperQ <= target {
+		return 0, false
+	}
+	if upperQ == 0 {
+		return end, true
+	}
+	// lowerP - e^ϵ·upperQ > target
+	return math.Min(end, math.Log((lowerP-target)/upperQ)), true
+}
+
+// confidence returns the confidence of each Clopper–Pearson interval, so that the bounds on δ hold with the given
+// confidence.
+func (d direction) confidence(confidence float64) float64 {
+	if len(d.q) == 0 {
+		return confidence
+	}
+	return 1 - (1-confidence)/2
+}
+
+// ClopperPearson returns the two-sided Clopper–Pearson confidence interval on the success probability of a binomial
+// distribution with k successes in n trials.
+func ClopperPearson(k, n int, confidence float64) (lower, upper float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	alpha := 1 - confidence
+	lower, upper = 0, 1
+	if k > 0 {
+		lower = distuv.Beta{Alpha: float64(k), Beta: float64(n - k + 1)}.Quantile(alpha / 2)
+	}
+	if k < n {
+		upper = distuv.Beta{Alpha: float64(k + 1), Beta: float64(n - k)}.Quantile(1 - alpha/2)
+	}
+	return lower, upper
+}
+
+// logRatio returns log(ratio), clamped to [1/MaxRatio, MaxRatio] so that a zero posterior doesn't produce -Inf.
+func logRatio(ratio float64) float64 {
+	return math.Log(math.Min(math.Max(ratio, 1.0/MaxRatio), MaxRatio))
+}
+
+func negate(x float64) float64 {
+	return -x
+}
+
+func clamp(delta float64) float64 {
+	return math.Min(math.Max(delta, 0), 1)
+}
@@ -0,0 +1,109 @@
+package privacy
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation"
+	"math"
+	"testing"
+)
+
+func TestClopperPearson(t *testing.T) {
+	lower, upper := ClopperPearson(0, 10, 0.95)
+	if lower != 0 || math.Abs(upper-(1-math.Pow(0.025, 0.1))) > 1e-9 {
+		t.Fatalf("Expected [0, %f], got [%f, %f]", 1-math.Pow(0.025, 0.1), lower, upper)
+	}
+	// reference values for 5 successes in 20 trials
+	lower, upper = ClopperPearson(5, 20, 0.95)
+	if math.Abs(lower-0.0866) > 1e-4 || math.Abs(upper-0.4910) > 1e-4 {
+		t.Fatalf("Expected [0.0866, 0.4910], got [%f, %f]", lower, upper)
+	}
+}
+
+func constant(value float64, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+func TestEstimator_DistinguishableScenarios(t *testing.T) {
+	n := 1000
+	r := data.Result{
+		View:      data.View{Ratios: constant(MaxRatio, n)},
+		Scenario1: data.View{Ratios: constant(1/MaxRatio, n)},
+	}
+	e := NewEstimator(r, 0.95)
+
+	if point := e.Delta(1); point.Delta != 1 || point.Upper != 1 {
+		t.Fatalf("Expected δ = 1 for perfectly distinguishable scenarios, got %+v", point)
+	}
+	if epsilon := e.Epsilon(0.01); math.Abs(epsilon-math.Log(MaxRatio)) > 1e-9 {
+		t.Fatalf("Expected ϵ = log(%f), got %f", MaxRatio, epsilon)
+	}
+	// no number of trials can show δ = 0
+	if epsilon := e.Epsilon(0); !math.IsInf(epsilon, 1) {
+		t.Fatalf("Expected ϵ = +Inf, got %f", epsilon)
+	}
+}
+
+func TestEstimator_BoundHoldsAtReportedEpsilon(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0, ServerLoad: 20, L: 3}
+	r, err := simulation.Run(p, 400, 1, 0)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	e := NewEstimator(*r, 0.95)
+
+	for _, target := range []float64{0.5, 0.2, 0.1, 0.05} {
+		epsilon := e.Epsilon(target)
+		if math.IsInf(epsilon, 1) {
+			continue
+		}
+		for _, point := range e.Curve([]float64{epsilon, epsilon + 0.1, epsilon + 1, epsilon + 5}) {
+			if point.Upper > target+1e-9 {
+				t.Fatalf("Upper bound %f at ϵ = %f exceeds target δ = %f (reported ϵ = %f)", point.Upper, point.Epsilon, target, epsilon)
+			}
+			if point.Lower > point.Delta || point.Delta > point.Upper {
+				t.Fatalf("Estimate outside of its confidence bounds: %+v", point)
+			}
+		}
+		// just below the reported ϵ, the bound no longer holds
+		if epsilon > 0 {
+			if point := e.Delta(math.Nextafter(epsilon, 0)); point.Upper <= target {
+				t.Fatalf("Upper bound %f at ϵ just below %f already meets target δ = %f", point.Upper, epsilon, target)
+			}
+		}
+	}
+}
+
+func TestEstimator_EpsilonIntervalNarrowsWithTrials(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0, ServerLoad: 20, L: 3}
+	r, err := simulation.Run(p, 1000, 1, 0)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	target := 0.05
+	width := math.Inf(1)
+	for _, n := range []int{50, 200, 1000} {
+		e := NewEstimator(r.Head(n), 0.95)
+		lower, upper := e.EpsilonInterval(target)
+		if upper != e.Epsilon(target) || lower > upper {
+			t.Fatalf("Invalid interval [%f, %f] with %d trials (ϵ = %f)", lower, upper, n, e.Epsilon(target))
+		}
+		// below the lower end, (ϵ, target)-DP is ruled out
+		if lower > 0 {
+			if point := e.Delta(math.Nextafter(lower, 0)); point.Lower <= target {
+				t.Fatalf("Lower bound %f at ϵ just below %f doesn't exceed target δ = %f", point.Lower, lower, target)
+			}
+		}
+		if upper-lower > width {
+			t.Fatalf("Expected the interval to narrow with %d trials, got width %f after %f", n, upper-lower, width)
+		}
+		width = upper - lower
+	}
+	if math.IsInf(width, 1) {
+		t.Fatalf("Expected a finite interval with 1000 trials")
+	}
+}
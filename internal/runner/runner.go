@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Runner runs simulation jobs: numRuns trials of the parameters p, starting from the given base seed.
+type Runner interface {
+	Run(ctx context.Context, p data.Parameters, numRuns int, seed int64) (*data.Result, error)
+}
+
+// InProcess runs jobs by calling simulation.Run directly.
+type InProcess struct {
+	Workers int // number of trials of a job to run in parallel (see simulation.Run)
+}
+
+func (r *InProcess) Run(ctx context.Context, p data.Parameters, numRuns int, seed int64) (*data.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v, err := simulation.Run(p, numRuns, seed, r.Workers)
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to run simulation for %s", p.Hash())
+	}
+	return v, nil
+}
+
+// Subprocess runs every job in its own process of cmd/simulation, isolating the caller from crashes and memory use
+// of the simulation at the cost of starting a process per job.
+type Subprocess struct {
+	Command []string // the command that runs cmd/simulation, e.g. ["go", "run", "cmd/simulation/main.go"]
+}
+
+func (r *Subprocess) Run(ctx context.Context, p data.Parameters, numRuns int, seed int64) (*data.Result, error) {
+	if len(r.Command) == 0 {
+		return nil, pl.NewError("no simulation command configured")
+	}
+	args := append(r.Command[1:len(r.Command):len(r.Command)], Args(p, numRuns, seed)...)
+	cmd := exec.CommandContext(ctx, r.Command[0], args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, pl.WrapError(err, "%s failed: %s", strings.Join(cmd.Args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	var v data.Result
+	if err := json.Unmarshal(stdout.Bytes(), &v); err != nil {
+		return nil, pl.WrapError(err, "failed to unmarshal output of %s", strings.Join(cmd.Args, " "))
+	}
+	return &v, nil
+}
+
+// Args returns the cmd/simulation flags that run numRuns trials of p starting from the given base seed.
+func Args(p data.Parameters, numRuns int, seed int64) []string {
+	return []string{
+		"-C", strconv.Itoa(p.C),
+		"-R", strconv.Itoa(p.R),
+		"-serverLoad", strconv.FormatFloat(p.ServerLoad, 'f', -1, 64),
+		"-X", strconv.FormatFloat(p.X, 'f', -1, 64),
+		"-L", strconv.Itoa(p.L),
+		"-t", strconv.Itoa(p.T),
+		"-bruiseThreshold", strconv.Itoa(p.BruiseThreshold),
+		"-adversary", p.Adversary,
+		"-epochs", strconv.Itoa(p.Epochs),
+		"-pattern", p.Pattern,
+		"-XClients", strconv.FormatFloat(p.XClients, 'f', -1, 64),
+		"-corruptedClients", strings.Join(utils.Map(p.CorruptedClients, strconv.Itoa), ","),
+		"-topology", p.Topology,
+		"-relayWeights", strings.Join(utils.Map(p.RelayWeights, func(weight float64) string {
+			return strconv.FormatFloat(weight, 'f', -1, 64)
+		}), ","),
+		"-numRuns", strconv.Itoa(numRuns),
+		"-seed", strconv.FormatInt(seed, 10),
+	}
+}
@@ -0,0 +1,36 @@
+package runner
+
+import (
+	"context"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"strings"
+	"testing"
+)
+
+func TestSubprocess_MatchesInProcess(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+
+	inProcess, err := (&InProcess{Workers: 2}).Run(context.Background(), p, 3, 11)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	subprocess, err := (&Subprocess{Command: []string{"go", "run", "../../cmd/simulation"}}).Run(context.Background(), p, 3, 11)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for i := range inProcess.Ratios {
+		if inProcess.Ratios[i] != subprocess.Ratios[i] || inProcess.Scenario1.Ratios[i] != subprocess.Scenario1.Ratios[i] {
+			t.Fatalf("Trial %d differs between in-process and subprocess runs", i)
+		}
+	}
+}
+
+func TestSubprocess_PropagatesErrors(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3, Adversary: "nope"}
+
+	_, err := (&Subprocess{Command: []string{"go", "run", "../../cmd/simulation"}}).Run(context.Background(), p, 1, 1)
+	if err == nil || !strings.Contains(err.Error(), "unknown adversary") {
+		t.Fatalf("Expected the simulation's error, got %v", err)
+	}
+}
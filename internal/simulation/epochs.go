@@ -0,0 +1,60 @@
+package simulation
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation/rounds"
+	"math"
+	"sort"
+)
+
+// intersection combines the adversary's observations of the epochs of a trial. As the target sends to the same
+// receiver in every epoch, and every epoch takes fresh paths, the adversary treats the epochs as independent
+// observations: its belief that the target sends to a receiver is proportional to the product of the receiver's
+// posterior over all epochs. A receiver to which some epoch assigns no mass is ruled out for good.
+type intersection struct {
+	logMass map[int]float64 // receiver id -> sum of the log of its posterior in every epoch
+}
+
+func newIntersection() *intersection {
+	return &intersection{
+		logMass: make(map[int]float64),
+	}
+}
+
+// add adds the posterior of the given epoch. An epoch in which the target's message never reached any receiver tells
+// the adversary nothing about the receiver, so it is skipped.
+func (in *intersection) add(system *rounds.Rounds) {
+	receivers := system.GetNodes(system.P.L + 1)
+	total := 0.0
+	for _, receiver := range receivers {
+		total += receiver.Probability
+	}
+	if total == 0 {
+		return
+	}
+	for _, receiver := range receivers {
+		in.logMass[receiver.Id] += math.Log(receiver.Probability / total)
+	}
+}
+
+// probabilities returns the adversary's normalized belief that the target sends to receiver0 and to receiver1.
+func (in *intersection) probabilities(receiver0, receiver1 int) (float64, float64) {
+	maxLogMass := math.Inf(-1)
+	for _, logMass := range in.logMass {
+		maxLogMass = math.Max(maxLogMass, logMass)
+	}
+	if math.IsInf(maxLogMass, -1) {
+		// every receiver was ruled out (or no epoch was added)
+		return 0, 0
+	}
+	// sum in the order of the receiver ids, as the order of a map varies from run to run and so would the last bits
+	ids := make([]int, 0, len(in.logMass))
+	for id := range in.logMass {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	total := 0.0
+	for _, id := range ids {
+		total += math.Exp(in.logMass[id] - maxLogMass)
+	}
+	return math.Exp(in.logMass[receiver0]-maxLogMass) / total, math.Exp(in.logMass[receiver1]-maxLogMass) / total
+}
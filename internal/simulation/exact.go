@@ -0,0 +1,185 @@
+package simulation
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation/rounds"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math"
+)
+
+// Distribution is a discrete distribution of the adversary's ratio Pr0/Pr1.
+type Distribution struct {
+	Ratios        []float64
+	Probabilities []float64
+}
+
+// ExactResult is the exact distribution of the adversary's ratio in each scenario, obtained by enumerating every
+// possible execution rather than sampling.
+type ExactResult struct {
+	P             data.Parameters
+	Scenarios     [2]Distribution
+	NumExecutions [2]int
+}
+
+// enumerator is a utils.Rand that, instead of drawing at random, walks depth-first through every possible sequence of
+// draws. Each call to next moves on to the following execution, like an odometer whose wheels are the draws.
+type enumerator struct {
+	choices []int // the value returned by each draw of the current execution
+	sizes   []int // the n passed to each draw of the current execution
+	pos     int
+}
+
+func (e *enumerator) Intn(n int) int {
+	if e.pos == len(e.choices) {
+		e.choices = append(e.choices, 0)
+		e.sizes = append(e.sizes, n)
+	} else if e.sizes[e.pos] != n {
+		// the same prefix of choices must always lead to the same draws
+		panic(pl.NewError("draw %d changed from Intn(%d) to Intn(%d) between executions", e.pos, e.sizes[e.pos], n))
+	}
+	e.pos++
+	return e.choices[e.pos-1]
+}
+
+// probability returns the probability of the current execution.
+func (e *enumerator) probability() float64 {
+	pr := 1.0
+	for _, n := range e.sizes[:e.pos] {
+		pr /= float64(n)
+	}
+	return pr
+}
+
+// next advances to the following execution, returning false once every execution has been visited.
+func (e *enumerator) next() bool {
+	e.choices = e.choices[:e.pos]
+	e.sizes = e.sizes[:e.pos]
+	for len(e.choices) > 0 {
+		last := len(e.choices) - 1
+		if e.choices[last]+1 < e.sizes[last] {
+			e.choices[last]++
+			e.pos = 0
+			return true
+		}
+		e.choices = e.choices[:last]
+		e.sizes = e.sizes[:last]
+	}
+	return false
+}
+
+// RunExact computes the exact distribution of the adversary's ratio in both scenarios by enumerating every execution
+// of the simulation (every permutation of destinations, checkpoint onion, path and corruption). The number of
+// executions grows exponentially with C, R and L, so it is only feasible for toy parameters; an error is returned if
+// a scenario has more than maxExecutions executions.
+func RunExact(p data.Parameters, maxExecutions int) (*ExactResult, error) {
+	if p.Epochs > 1 {
+		return nil, pl.NewError("exact mode only supports a single epoch")
+	}
+	// a weighted draw (utils.RandomWeightedIndexFrom) has 2^30 outcomes, far too many to enumerate
+	if len(p.RelayWeights) > 0 {
+		return nil, pl.NewError("exact mode doesn't support relay weights, as it can't enumerate weighted draws")
+	}
+	if pattern, err := rounds.NewTrafficPattern(p.Pattern); err == nil {
+		if _, weighted := pattern.(*rounds.ZipfPattern); weighted {
+			return nil, pl.NewError("exact mode doesn't support the %q traffic pattern, as it can't enumerate weighted draws", p.Pattern)
+		}
+	}
+
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	result := &ExactResult{P: p}
+
+	for scenario := range result.Scenarios {
+		distribution := make(map[float64]float64)
+
+		e := &enumerator{}
+		for more := true; more; more = e.next() {
+			if result.NumExecutions[scenario] >= maxExecutions {
+				return nil, pl.NewError("scenario %d has more than %d executions", scenario, maxExecutions)
+			}
+			result.NumExecutions[scenario]++
+
+			system, err := rounds.SetUpSystem(clientIds, relayIds, p, scenario, e)
+			if err != nil {
+				return nil, pl.WrapError(err, "failed to run execution %d", result.NumExecutions[scenario])
+			}
+			system.ComputePosterior()
+
+			// executions whose ratios only differ by rounding error are the same outcome
+			ratio := math.Round(system.GetRatio()*1e9) / 1e9
+			distribution[ratio] += e.probability()
+		}
+
+		ratios := utils.GetKeys(distribution)
+		utils.SortOrdered(ratios)
+		result.Scenarios[scenario] = Distribution{
+			Ratios: ratios,
+			Probabilities: utils.Map(ratios, func(ratio float64) float64 {
+				return distribution[ratio]
+			}),
+		}
+	}
+
+	return result, nil
+}
+
+// Mean returns the expected ratio.
+func (d Distribution) Mean() float64 {
+	mean := 0.0
+	for i, ratio := range d.Ratios {
+		mean += ratio * d.Probabilities[i]
+	}
+	return mean
+}
+
+// Delta returns the smallest δ for which Pr[View(σ0) ∈ V] ≤ e^ϵ·Pr[View(σ1) ∈ V] + δ, and vice versa, holds for every
+// set V of ratios.
+func (e *ExactResult) Delta(epsilon float64) float64 {
+	p0 := e.Scenarios[0].asMap()
+	p1 := e.Scenarios[1].asMap()
+	return math.Max(hockeyStick(p0, p1, epsilon), hockeyStick(p1, p0, epsilon))
+}
+
+// Epsilon returns the smallest ϵ for which Delta(ϵ) ≤ delta (to within 1e-9).
+func (e *ExactResult) Epsilon(delta float64) float64 {
+	// the largest log ratio between the two distributions always suffices
+	hi := 0.0
+	p1 := e.Scenarios[1].asMap()
+	for ratio, pr0 := range e.Scenarios[0].asMap() {
+		if pr1, present := p1[ratio]; present {
+			hi = math.Max(hi, math.Abs(math.Log(pr0/pr1)))
+		}
+	}
+	if e.Delta(hi) > delta {
+		return math.Inf(1)
+	}
+	lo := 0.0
+	for hi-lo > 1e-9 {
+		mid := (lo + hi) / 2
+		if e.Delta(mid) <= delta {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi
+}
+
+func (d Distribution) asMap() map[float64]float64 {
+	m := make(map[float64]float64)
+	for i, ratio := range d.Ratios {
+		m[ratio] = d.Probabilities[i]
+	}
+	return m
+}
+
+// hockeyStick returns Σ_v max(0, p(v) - e^ϵ·q(v)).
+func hockeyStick(p, q map[float64]float64, epsilon float64) float64 {
+	delta := 0.0
+	for v, pr := range p {
+		delta += math.Max(0.0, pr-math.Exp(epsilon)*q[v])
+	}
+	return delta
+}
@@ -0,0 +1,82 @@
+package simulation
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRunExact_MatchesMonteCarlo(t *testing.T) {
+	p := data.Parameters{C: 3, R: 1, X: 0.0, ServerLoad: 6, L: 2}
+
+	exact, err := RunExact(p, 10000)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for scenario, d := range exact.Scenarios {
+		if total := utils.Sum(d.Probabilities); math.Abs(total-1.0) > 1e-9 {
+			t.Fatalf("Scenario %d: probabilities sum to %f", scenario, total)
+		}
+	}
+
+	sampled, err := Run(p, 20000, 1, 0)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for scenario, d := range exact.Scenarios {
+		if mean := utils.Mean(sampled.Scenario(scenario).Ratios); math.Abs(mean-d.Mean()) > 0.05*d.Mean() {
+			t.Fatalf("Scenario %d: Monte-Carlo mean %f is far from exact mean %f", scenario, mean, d.Mean())
+		}
+	}
+}
+
+func TestRunExact_TooManyExecutions(t *testing.T) {
+	if _, err := RunExact(data.Parameters{C: 10, R: 5, X: 0.2, ServerLoad: 10, L: 3}, 100); err == nil {
+		t.Fatalf("Expected an error")
+	}
+}
+
+func TestRunExact_RejectsWeightedDraws(t *testing.T) {
+	zipf := data.Parameters{C: 4, R: 2, X: 0, ServerLoad: 2, L: 1, Pattern: "zipf:1.5"}
+	weights := data.Parameters{C: 4, R: 2, X: 0, ServerLoad: 2, L: 1, RelayWeights: []float64{1, 2}}
+	for _, weighted := range []data.Parameters{zipf, weights} {
+		if _, err := RunExact(weighted, 1000000); err == nil || !strings.Contains(err.Error(), "weighted draws") {
+			t.Fatalf("Expected an error about weighted draws, got %v", err)
+		}
+	}
+}
+
+// TestRun_SamplesOnlyExactRatios checks that every ratio sampled by Run is one of the outcomes enumerated by RunExact,
+// which computes the posterior of every execution of the same parameters.
+func TestRun_SamplesOnlyExactRatios(t *testing.T) {
+	for _, p := range []data.Parameters{
+		{C: 3, R: 1, X: 0.0, ServerLoad: 6, L: 2},
+		{C: 3, R: 2, X: 0.5, ServerLoad: 1, L: 2, Adversary: "selective"},
+		{C: 3, R: 2, X: 0.5, ServerLoad: 1, L: 2, T: 1, Adversary: "selective"},
+		{C: 3, R: 2, X: 0.5, ServerLoad: 1, L: 2, Adversary: "bruise", BruiseThreshold: 1},
+		{C: 3, R: 2, X: 0.5, ServerLoad: 1, L: 2, Adversary: "selective", Topology: "stratified"},
+	} {
+		exact, err := RunExact(p, 10000)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		sampled, err := Run(p, 500, 1, 0)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for scenario, d := range exact.Scenarios {
+			outcomes := make(map[float64]bool, len(d.Ratios))
+			for _, ratio := range d.Ratios {
+				outcomes[ratio] = true
+			}
+			for i, ratio := range sampled.Scenario(scenario).Ratios {
+				if !outcomes[math.Round(ratio*1e9)/1e9] {
+					t.Fatalf("%s: scenario %d, trial %d: ratio %f is not the outcome of any execution", p.Hash(), scenario, i, ratio)
+				}
+			}
+		}
+	}
+}
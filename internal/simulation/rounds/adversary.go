@@ -0,0 +1,177 @@
+package rounds
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"sort"
+)
+
+// Action is what the adversary does with an onion it holds.
+type Action int
+
+const (
+	// Forward passes the onion on to its next hop as an honest relay would.
+	Forward Action = iota
+	// Drop discards the onion.
+	Drop
+	// Delay holds the onion back so that it reaches its next hop after that hop's round has been mixed. Without
+	// bruising, an honest relay processes a late onion on its own, so the adversary can link it through that relay;
+	// with bruising, the relay bruises it instead.
+	Delay
+	// Bruise forwards the onion with one more bruise. Honest relays discard onions with BruiseThreshold bruises.
+	Bruise
+)
+
+// Adversary is a strategy for attacking a single trial. SetUpSystem asks it to corrupt relays once all paths have
+// been chosen, then consults it for every onion it holds in each round: the adversary controls the links leaving the
+// clients (round 0) and every corrupted relay. Finally, it turns its view (the graph) into a posterior.
+type Adversary interface {
+	// Corrupt returns the ids of the relays to corrupt. The budget is int(X * R) relays.
+	Corrupt(r *Rounds, relayIds []int) []int
+	// Act decides what happens to onion o, which the adversary holds in the given round.
+	Act(r *Rounds, round int, o *Onion) Action
+	// Posterior sets the Probability of every node to the adversary's belief that the target message passed through it.
+	Posterior(r *Rounds)
+}
+
+var adversaries = map[string]func() Adversary{
+	"default":   func() Adversary { return &DefaultAdversary{} },
+	"selective": func() Adversary { return &SelectiveDropAdversary{} },
+	"delay":     func() Adversary { return &DelayAdversary{} },
+	"adaptive":  func() Adversary { return &AdaptiveAdversary{} },
+	"bruise":    func() Adversary { return &BruisingAdversary{} },
+	"weighted":  func() Adversary { return &WeightedAdversary{} },
+}
+
+// NewAdversary returns the adversary strategy with the given name ("" selects the default strategy).
+func NewAdversary(name string) (Adversary, error) {
+	if name == "" {
+		name = "default"
+	}
+	if newAdversary, present := adversaries[name]; present {
+		return newAdversary(), nil
+	}
+	return nil, pl.NewError("unknown adversary %q (expected one of %v)", name, AdversaryNames())
+}
+
+// AdversaryNames returns the names accepted by NewAdversary.
+func AdversaryNames() []string {
+	names := utils.GetKeys(adversaries)
+	sort.Strings(names)
+	return names
+}
+
+// DefaultAdversary corrupts a uniformly random subset of relays and drops every onion from C_1 before it reaches the
+// first relay. Its posterior spreads the probability mass of C_2's message over the graph.
+type DefaultAdversary struct{}
+
+func (a *DefaultAdversary) Corrupt(r *Rounds, relayIds []int) []int {
+	return utils.RandomSubsetFrom(r.rng, relayIds, r.CorruptionBudget())
+}
+
+func (a *DefaultAdversary) Act(r *Rounds, round int, o *Onion) Action {
+	if round == 0 && o.Sender() == r.DropTarget() {
+		return Drop
+	}
+	return Forward
+}
+
+func (a *DefaultAdversary) Posterior(r *Rounds) {
+	initial := make(map[int]float64)
+	for _, clientId := range r.clientIds {
+		initial[clientId] = 0.0
+	}
+	initial[r.Target()] = 1.0
+
+	r.CalculateProbabilities(initial)
+}
+
+// SelectiveDropAdversary cannot interfere with the clients' links. It only drops an onion from C_1 at a corrupted relay,
+// and only if every earlier hop was corrupted too (so it can still tell the onion came from C_1).
+type SelectiveDropAdversary struct {
+	DefaultAdversary
+}
+
+func (a *SelectiveDropAdversary) Act(r *Rounds, round int, o *Onion) Action {
+	if round > 0 && o.Sender() == r.DropTarget() && r.IsTraceable(o, round) {
+		return Drop
+	}
+	return Forward
+}
+
+// DelayAdversary behaves like DefaultAdversary, but also delays every onion it can trace back to C_2 at a corrupted
+// relay, so that the next honest relay cannot mix it with the rest of its batch.
+type DelayAdversary struct {
+	DefaultAdversary
+}
+
+func (a *DelayAdversary) Act(r *Rounds, round int, o *Onion) Action {
+	if round > 0 && o.Sender() == r.Target() && r.IsTraceable(o, round) {
+		return Delay
+	}
+	return a.DefaultAdversary.Act(r, round, o)
+}
+
+// BruisingAdversary behaves like SelectiveDropAdversary, but bruises the onions of C_1 instead of dropping them, so
+// that they are discarded by an honest relay rather than going missing at a corrupted one.
+type BruisingAdversary struct {
+	DefaultAdversary
+}
+
+func (a *BruisingAdversary) Act(r *Rounds, round int, o *Onion) Action {
+	if round > 0 && o.Sender() == r.DropTarget() && r.IsTraceable(o, round) {
+		return Bruise
+	}
+	return Forward
+}
+
+// AdaptiveAdversary chooses its corruptions after the paths have been fixed, spending its budget on the relays that the
+// onions of C_1 and C_2 pass through most often. This gives worst-case rather than average-case privacy. Any budget
+// left over once those relays are exhausted is spent on a uniformly random subset of the remaining relays.
+type AdaptiveAdversary struct {
+	DefaultAdversary
+}
+
+func (a *AdaptiveAdversary) Corrupt(r *Rounds, relayIds []int) []int {
+	budget := r.CorruptionBudget()
+
+	visits := make(map[int]int)
+	for _, o := range r.Onions() {
+		if o.Sender() == r.DropTarget() || o.Sender() == r.Target() {
+			for _, relayId := range o.Path[1 : len(o.Path)-1] {
+				visits[relayId]++
+			}
+		}
+	}
+
+	busiest := utils.GetKeys(visits)
+	utils.Sort(busiest, func(i, j int) bool {
+		if visits[i] != visits[j] {
+			return visits[i] > visits[j]
+		}
+		return i < j
+	})
+	if len(busiest) >= budget {
+		return busiest[:budget]
+	}
+
+	rest := utils.Filter(relayIds, func(relayId int) bool {
+		return visits[relayId] == 0
+	})
+	return append(busiest, utils.RandomSubsetFrom(r.rng, rest, budget-len(busiest))...)
+}
+
+// WeightedAdversary behaves like DefaultAdversary, but spends its budget on the relays with the largest weight (see
+// Rounds.RelayWeight), which see the most traffic. Ties are broken at random, so without weights this is the same as
+// corrupting a uniformly random subset.
+type WeightedAdversary struct {
+	DefaultAdversary
+}
+
+func (a *WeightedAdversary) Corrupt(r *Rounds, relayIds []int) []int {
+	heaviest := utils.GetShuffledCopyFrom(r.rng, relayIds)
+	sort.SliceStable(heaviest, func(i, j int) bool {
+		return r.RelayWeight(heaviest[i]) > r.RelayWeight(heaviest[j])
+	})
+	return heaviest[:utils.Min(r.CorruptionBudget(), len(heaviest))]
+}
@@ -0,0 +1,200 @@
+package rounds
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math/rand"
+	"testing"
+)
+
+func TestAdaptiveAdversary_CorruptsBusiestRelays(t *testing.T) {
+	p := data.Parameters{C: 30, R: 10, X: 0.3, ServerLoad: 10, L: 4, Adversary: "adaptive"}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	visits := make(map[int]int)
+	for _, o := range system.Onions() {
+		if o.Sender() == system.DropTarget() || o.Sender() == system.Target() {
+			for _, relayId := range o.Path[1 : len(o.Path)-1] {
+				visits[relayId]++
+			}
+		}
+	}
+
+	corrupted := utils.Filter(relayIds, func(relayId int) bool {
+		return system.Get(1, relayId).IsCorrupted
+	})
+	if len(corrupted) != system.CorruptionBudget() {
+		t.Fatalf("Expected %d corrupted relays, got %d", system.CorruptionBudget(), len(corrupted))
+	}
+	for _, c := range corrupted {
+		for _, relayId := range relayIds {
+			if !utils.ContainsElement(corrupted, relayId) && visits[relayId] > visits[c] {
+				t.Fatalf("Relay %d (%d visits) is honest but relay %d (%d visits) is corrupted", relayId, visits[relayId], c, visits[c])
+			}
+		}
+	}
+}
+
+func TestNewAdversary_UnknownName(t *testing.T) {
+	if _, err := NewAdversary("nope"); err == nil {
+		t.Fatalf("Expected an error")
+	}
+}
+
+func TestSelectiveDropAdversary_DropsOnlyTraceableOnionsOfTarget(t *testing.T) {
+	p := data.Parameters{C: 30, R: 10, X: 0.5, ServerLoad: 10, L: 4, Adversary: "selective"}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	dropped, delivered := 0, 0
+	for seed := int64(0); seed < 10; seed++ {
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(seed)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for _, o := range system.Onions() {
+			if o.Sender() != system.DropTarget() {
+				if o.IsDropped() {
+					t.Fatalf("Seed %d: dropped an onion of client %d", seed, o.Sender())
+				}
+				continue
+			}
+			// past an honest relay the adversary can no longer tell the onion came from C_1, so it is dropped (from
+			// round 2) if and only if its first relay is corrupted
+			expected := 0
+			if system.IsCorrupted(1, o.Path[1]) {
+				expected = 2
+			}
+			if o.DroppedAt != expected {
+				t.Fatalf("Seed %d: expected the onion with path %v to be dropped from round %d, got %d", seed, o.Path, expected, o.DroppedAt)
+			}
+			if o.IsDropped() {
+				dropped++
+			} else {
+				delivered++
+			}
+		}
+	}
+	if dropped == 0 || delivered == 0 {
+		t.Fatalf("Expected some of C_1's onions to be dropped and some to be delivered, got %d and %d", dropped, delivered)
+	}
+}
+
+func TestDelayAdversary_DelaysTraceableOnionsOfTarget(t *testing.T) {
+	p := data.Parameters{C: 30, R: 10, X: 0.5, ServerLoad: 10, L: 4, Adversary: "delay"}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	late := 0
+	for seed := int64(0); seed < 10; seed++ {
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(seed)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for _, o := range system.Onions() {
+			for l := 1; l < len(o.Path); l++ {
+				// an onion of C_2 arrives late after every corrupted relay at which it can still be traced
+				expected := o.Sender() == system.Target() && l >= 2 && system.IsCorrupted(l-1, o.Path[l-1]) &&
+					system.IsTraceable(o, l-1)
+				if o.IsLate(l) != expected {
+					t.Fatalf("Seed %d: expected the onion of client %d with path %v to be late in round %d: %v", seed, o.Sender(), o.Path, l, expected)
+				}
+				if o.IsLate(l) {
+					late++
+				}
+			}
+			if o.Sender() == system.Target() && o.IsDropped() {
+				t.Fatalf("Seed %d: expected the delayed onions to be delivered", seed)
+			}
+		}
+	}
+	if late == 0 {
+		t.Fatalf("Expected some of C_2's onions to arrive late")
+	}
+}
+
+func TestBruiseThreshold_HonestRelayDiscardsAtThreshold(t *testing.T) {
+	r := &Rounds{P: data.Parameters{C: 10, R: 5, ServerLoad: 10, L: 3, BruiseThreshold: 2}}
+
+	below := newOnion([]int{1, 11, 12, 13, 10}, false)
+	below.Bruises = 1
+	r.processAtHonestRelay(2, below)
+	if below.IsDropped() || below.Bruises != 1 {
+		t.Fatalf("Expected an onion with 1 bruise to be forwarded, got %+v", below)
+	}
+
+	at := newOnion([]int{1, 11, 12, 13, 10}, false)
+	at.Bruises = 2
+	r.processAtHonestRelay(2, at)
+	if at.DroppedAt != 3 {
+		t.Fatalf("Expected an onion with 2 bruises to be discarded after round 2, got %+v", at)
+	}
+
+	// a late onion is bruised and mixed with the batch instead of being processed on its own
+	late := newOnion([]int{1, 11, 12, 13, 10}, false)
+	late.Bruises = 1
+	late.delay(2)
+	r.processAtHonestRelay(2, late)
+	if late.IsLate(2) || late.Bruises != 2 || late.DroppedAt != 3 {
+		t.Fatalf("Expected a late onion with 1 bruise to be bruised and discarded after round 2, got %+v", late)
+	}
+
+	r.P.BruiseThreshold = 0
+	unbruised := newOnion([]int{1, 11, 12, 13, 10}, false)
+	unbruised.Bruises = 5
+	r.processAtHonestRelay(2, unbruised)
+	if unbruised.IsDropped() {
+		t.Fatalf("Expected onions to be forwarded without a bruise threshold")
+	}
+}
+
+func TestBruisingAdversary_OnionsDiscardedByHonestRelays(t *testing.T) {
+	p := data.Parameters{C: 30, R: 10, X: 0.5, ServerLoad: 10, L: 4, Adversary: "bruise", BruiseThreshold: 1}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	discarded := 0
+	for seed := int64(0); seed < 10; seed++ {
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(seed)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for _, o := range system.Onions() {
+			if o.Sender() != system.DropTarget() {
+				if o.Bruises != 0 || o.IsDropped() {
+					t.Fatalf("Seed %d: expected the onions of client %d to be left alone, got %+v", seed, o.Sender(), o)
+				}
+				continue
+			}
+			if o.Bruises == 0 {
+				if o.IsDropped() {
+					t.Fatalf("Seed %d: dropped an unbruised onion with path %v", seed, o.Path)
+				}
+				continue
+			}
+			// bruised at the corrupted relays it was traceable through, then discarded by the next honest relay (if it
+			// meets one)
+			honest := 1
+			for honest <= p.L && system.IsCorrupted(honest, o.Path[honest]) {
+				honest++
+			}
+			expected := honest + 1
+			if honest > p.L {
+				expected = 0
+			}
+			if o.Bruises != honest-1 || o.DroppedAt != expected {
+				t.Fatalf("Seed %d: expected the onion with path %v to be discarded by the relay in round %d, got %+v", seed, o.Path, honest, o)
+			}
+			discarded++
+		}
+	}
+	if discarded == 0 {
+		t.Fatalf("Expected some of C_1's onions to be discarded")
+	}
+}
@@ -0,0 +1,46 @@
+package rounds
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math/rand"
+	"testing"
+)
+
+// The benchmarks only use the API that the linked-node implementation of the rounds already had, so that the two can be
+// compared (see the README).
+
+// benchmarkParameters are large enough that the graph, rather than the draws, dominates: about 6 onions per client,
+// each visiting 5 relays.
+var benchmarkParameters = data.Parameters{C: 20000, R: 200, X: 0.2, ServerLoad: 500, L: 5}
+
+func BenchmarkSetUpSystem(b *testing.B) {
+	p := benchmarkParameters
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(int64(i)))); err != nil {
+			b.Fatalf("Error: %v", err)
+		}
+	}
+}
+
+func BenchmarkComputePosterior(b *testing.B) {
+	p := benchmarkParameters
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(int64(i))))
+		if err != nil {
+			b.Fatalf("Error: %v", err)
+		}
+		b.StartTimer()
+		system.ComputePosterior()
+		system.RoundRatios()
+	}
+}
@@ -0,0 +1,22 @@
+package rounds
+
+// bruisingEnabled reports whether onions are tulip (bruisable) onions, i.e. whether BruiseThreshold is set.
+func (r *Rounds) bruisingEnabled() bool {
+	return r.P.BruiseThreshold > 0
+}
+
+// processAtHonestRelay applies the tulip onion rules at the honest relay holding onion o in the given round. Instead of
+// processing a late onion on its own (which would let the adversary link it), the relay bruises it and mixes it with
+// the rest of its batch. Onions that carry BruiseThreshold bruises are discarded.
+func (r *Rounds) processAtHonestRelay(round int, o *Onion) {
+	if !r.bruisingEnabled() {
+		return
+	}
+	if o.IsLate(round) {
+		delete(o.late, round)
+		o.Bruises++
+	}
+	if o.Bruises >= r.P.BruiseThreshold {
+		o.drop(round + 1)
+	}
+}
@@ -0,0 +1,51 @@
+package rounds
+
+// checkpointVerifier models the Π_t checkpoint rule. Every honest relay knows which checkpoint onions it should
+// receive in each round; it counts those that fail to arrive, and once more than the threshold T are missing it stops
+// forwarding (every onion it holds in that round or any later round is dropped). Because aborting relays drop
+// checkpoint onions of their own, aborts can cascade to relays in later rounds.
+type checkpointVerifier struct {
+	r       *Rounds
+	missing map[int]int // relay -> checkpoint onions that failed to arrive so far
+}
+
+func newCheckpointVerifier(r *Rounds) *checkpointVerifier {
+	return &checkpointVerifier{
+		r:       r,
+		missing: make(map[int]int),
+	}
+}
+
+// verify applies the checkpoint rule at every honest relay in the given round. It must be called once the fate of
+// every onion in the previous rounds has been decided.
+func (v *checkpointVerifier) verify(round int) {
+	if v.r.P.T <= 0 {
+		return
+	}
+	// the onions are scanned rather than indexed by relay, which would take a pointer per onion and round
+	isHonestAndActive := func(relayId int) bool {
+		_, aborted := v.r.abortedAt[relayId]
+		return !aborted && !v.r.IsCorrupted(round, relayId)
+	}
+	for _, o := range v.r.onions {
+		if o.IsCheckpoint && !o.Reached(round) && isHonestAndActive(o.Path[round]) {
+			v.missing[o.Path[round]]++
+		}
+	}
+	for _, relayId := range v.r.g.ids(round) {
+		if isHonestAndActive(relayId) && v.missing[relayId] > v.r.P.T {
+			v.r.abortedAt[relayId] = round
+		}
+	}
+	for _, o := range v.r.onions {
+		relayId := o.Path[round]
+		if _, aborted := v.r.abortedAt[relayId]; aborted && !v.r.IsCorrupted(round, relayId) {
+			o.drop(round + 1)
+		}
+	}
+}
+
+// NumAborted returns the number of honest relays that stopped forwarding because of missing checkpoint onions.
+func (r *Rounds) NumAborted() int {
+	return len(r.abortedAt)
+}
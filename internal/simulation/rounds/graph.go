@@ -0,0 +1,211 @@
+package rounds
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation/rounds/node"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"sort"
+)
+
+// graph is the adversary's view of a trial in flat arrays. Its hops are the clients in rounds 0 and L+1 and the relays
+// in rounds 1 to L, numbered round by round and, within a round, in order of id. For every hop it records whether it
+// is corrupted, its probability mass, and the number of onions it mixed; every onion passed from one mixing hop to the
+// next is recorded as a link. The graph is only ever touched by the goroutine running its trial, so it has no locks.
+type graph struct {
+	L           int
+	index       []int32 // id -> index of the client or relay among its kind (-1 if it is neither)
+	clientIds   []int   // sorted
+	relayIds    []int   // sorted
+	corrupted   []bool
+	probability []float64
+	numMixed    []int32
+	links       []link // grouped by the hop they leave and merged once compacted
+	compacted   bool
+	start       []int32 // once compacted, the links leaving hop h are links[start[h]:start[h+1]]
+}
+
+// link records count onions passed from hop from to hop to.
+type link struct {
+	from, to int32
+	count    int32
+}
+
+func newGraph(clientIds, relayIds []int, L int) *graph {
+	g := &graph{
+		L:         L,
+		clientIds: sorted(clientIds),
+		relayIds:  sorted(relayIds),
+	}
+	maxId := 0
+	for _, id := range append(utils.Copy(clientIds), relayIds...) {
+		maxId = utils.Max(maxId, id)
+	}
+	g.index = make([]int32, maxId+1)
+	for i := range g.index {
+		g.index[i] = -1
+	}
+	for i, id := range g.clientIds {
+		g.index[id] = int32(i)
+	}
+	for i, id := range g.relayIds {
+		g.index[id] = int32(i)
+	}
+
+	size := g.roundStart(L + 2)
+	g.corrupted = make([]bool, size)
+	g.probability = make([]float64, size)
+	g.numMixed = make([]int32, size)
+	return g
+}
+
+func sorted(ids []int) []int {
+	ids = utils.Copy(ids)
+	sort.Ints(ids)
+	return ids
+}
+
+// roundStart returns the index of the first hop of the given round.
+func (g *graph) roundStart(round int) int {
+	switch {
+	case round <= 0:
+		return 0
+	case round <= g.L+1:
+		return len(g.clientIds) + (round-1)*len(g.relayIds)
+	default:
+		return 2*len(g.clientIds) + g.L*len(g.relayIds)
+	}
+}
+
+// ids returns the ids of the hops in the given round, in order.
+func (g *graph) ids(round int) []int {
+	if round == 0 || round == g.L+1 {
+		return g.clientIds
+	}
+	if round > 0 && round <= g.L {
+		return g.relayIds
+	}
+	return nil
+}
+
+// hop returns the index of the hop of the given id in the given round, or -1 if there is no such hop.
+func (g *graph) hop(round, id int) int {
+	if id < 0 || id >= len(g.index) || g.index[id] < 0 {
+		return -1
+	}
+	ids := g.ids(round)
+	i := int(g.index[id])
+	if i >= len(ids) || ids[i] != id {
+		return -1
+	}
+	return g.roundStart(round) + i
+}
+
+// round returns the round of hop h.
+func (g *graph) round(h int) int {
+	if h < len(g.clientIds) {
+		return 0
+	}
+	if h >= g.roundStart(g.L+1) {
+		return g.L + 1
+	}
+	return 1 + (h-len(g.clientIds))/len(g.relayIds)
+}
+
+// id returns the id of hop h.
+func (g *graph) id(h int) int {
+	round := g.round(h)
+	return g.ids(round)[h-g.roundStart(round)]
+}
+
+// addLink records one more onion passed from hop from to hop to.
+func (g *graph) addLink(from, to int) {
+	g.links = append(g.links, link{from: int32(from), to: int32(to), count: 1})
+	g.compacted = false
+}
+
+// linksFrom returns the links leaving hop h, in the order they were first added.
+func (g *graph) linksFrom(h int) []link {
+	g.compact()
+	return g.links[g.start[h]:g.start[h+1]]
+}
+
+// compact groups the links by the hop they leave and merges those between the same hops.
+func (g *graph) compact() {
+	if g.compacted {
+		return
+	}
+
+	// bucket the links by the hop they leave (a counting sort, as there are far more links than hops)
+	start := make([]int32, len(g.numMixed)+1)
+	for _, l := range g.links {
+		start[l.from+1]++
+	}
+	for h := 1; h < len(start); h++ {
+		start[h] += start[h-1]
+	}
+	bucketed := make([]link, len(g.links))
+	next := utils.Copy(start[:len(start)-1])
+	for _, l := range g.links {
+		bucketed[next[l.from]] = l
+		next[l.from]++
+	}
+
+	// merge the links of each bucket that lead to the same hop, overwriting the buckets from the front; position[to]
+	// is where the bucket's link to hop to was merged, if it is within the bucket
+	position := make([]int32, len(g.numMixed))
+	merged := bucketed[:0]
+	for h := 0; h+1 < len(start); h++ {
+		bucket := bucketed[start[h]:start[h+1]]
+		start[h] = int32(len(merged))
+		for _, l := range bucket {
+			if i := position[l.to]; i >= start[h] && i < int32(len(merged)) && merged[i].to == l.to {
+				merged[i].count += l.count
+			} else {
+				position[l.to] = int32(len(merged))
+				merged = append(merged, l)
+			}
+		}
+	}
+	start[len(start)-1] = int32(len(merged))
+
+	g.links = merged
+	g.start = start
+	g.compacted = true
+}
+
+// nodes returns a snapshot of the given hops as nodes, linked to (shallow snapshots of) the hops they sent onions to
+// and received onions from.
+func (g *graph) nodes(hops []int) []*node.Node {
+	g.compact()
+	snapshot := func(h int) *node.Node {
+		return &node.Node{
+			Id:           g.id(h),
+			Round:        g.round(h),
+			ReceivedFrom: make([]*node.Node, 0),
+			SentTo:       make([]*node.Node, 0),
+			NumMixed:     int(g.numMixed[h]),
+			IsCorrupted:  g.corrupted[h],
+			Probability:  g.probability[h],
+		}
+	}
+	nodes := make([]*node.Node, len(hops))
+	byHop := make(map[int]*node.Node, len(hops))
+	for i, h := range hops {
+		nodes[i] = snapshot(h)
+		byHop[h] = nodes[i]
+	}
+	for _, l := range g.links {
+		if n, present := byHop[int(l.from)]; present {
+			next := snapshot(int(l.to))
+			for c := int32(0); c < l.count; c++ {
+				n.AddSentTo(next)
+			}
+		}
+		if n, present := byHop[int(l.to)]; present {
+			previous := snapshot(int(l.from))
+			for c := int32(0); c < l.count; c++ {
+				n.AddReceivedFrom(previous)
+			}
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,52 @@
+package rounds
+
+// RoundRatios returns, for every round l from 0 to L+1, the ratio Pr0/Pr1 the adversary would compute if the onions
+// had been delivered straight to their receivers after round l, i.e. if every later hop had been transparent.
+//
+// Every onion mixed by a node is equally likely to be the target, so an onion whose last mixing hop by round l is h
+// carries the mass of h divided by the number of onions h mixed, and Pr0 (Pr1) is the mass carried by the delivered
+// onions bound for C_{R-1} (C_R), leaving out the onions the adversary knows are not the target. The ratio after
+// round 0 is what the adversary learns without any honest mixing, and the ratio after round L+1 is GetRatio.
+// ComputePosterior must have been called first.
+func (r *Rounds) RoundRatios() []float64 {
+	ratios := make([]float64, r.P.L+2)
+	for l := range ratios {
+		pr0, pr1 := 0.0, 0.0
+		for _, o := range r.onions {
+			if o.IsDropped() || (o.Receiver() != r.P.C-1 && o.Receiver() != r.P.C) {
+				continue
+			}
+			// find last hop that mixed the onion
+			h := l
+			for r.isTransparent(o, h) {
+				h--
+			}
+			if h >= r.excludedFrom(o) {
+				continue
+			}
+			hop := r.g.hop(h, o.Path[h])
+			if r.g.numMixed[hop] == 0 {
+				continue
+			}
+			mass := r.g.probability[hop] / float64(r.g.numMixed[hop])
+			if o.Receiver() == r.P.C-1 {
+				pr0 += mass
+			} else {
+				pr1 += mass
+			}
+		}
+		ratios[l] = Ratio(pr0, pr1)
+	}
+	return ratios
+}
+
+// Ratio returns pr0/pr1, or 1000 if only pr1 is zero and 1 if both are.
+func Ratio(pr0, pr1 float64) float64 {
+	if pr1 == 0 {
+		if pr0 == 0 {
+			return 1.0
+		}
+		return 1000.0
+	}
+	return pr0 / pr1
+}
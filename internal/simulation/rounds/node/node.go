@@ -1,25 +1,42 @@
 package node
 
-import "sync"
-
+// Node is a snapshot of a hop of the adversary's view: a client in round 0 or L+1, or a relay in rounds 1 to L.
 type Node struct {
 	Id           int
 	Round        int
 	ReceivedFrom []*Node
-	SentTo       []*Node
+	SentTo       []*Node       // distinct nodes this node sent onions to
+	Multiplicity map[*Node]int // number of onions sent to each node in SentTo
+	NumMixed     int           // number of onions this node mixed, including any it discarded
 	IsCorrupted  bool
 	Probability  float64
-	mu           sync.RWMutex
 }
 
+// AddSentTo records one more onion sent from n to receiver.
 func (n *Node) AddSentTo(receiver *Node) {
-	n.mu.Lock()
-	defer n.mu.Unlock()
-	n.SentTo = append(n.SentTo, receiver)
+	if n.Multiplicity == nil {
+		n.Multiplicity = make(map[*Node]int)
+	}
+	if n.Multiplicity[receiver] == 0 {
+		n.SentTo = append(n.SentTo, receiver)
+	}
+	n.Multiplicity[receiver]++
 }
 
 func (n *Node) AddReceivedFrom(sender *Node) {
-	n.mu.Lock()
-	defer n.mu.Unlock()
 	n.ReceivedFrom = append(n.ReceivedFrom, sender)
 }
+
+// AddMixed records one more onion mixed by n.
+func (n *Node) AddMixed() {
+	n.NumMixed++
+}
+
+// FractionSentTo returns the fraction of the onions mixed by n that were sent to receiver, i.e. the probability that
+// any particular one of them went there.
+func (n *Node) FractionSentTo(receiver *Node) float64 {
+	if n.NumMixed == 0 {
+		return 0.0
+	}
+	return float64(n.Multiplicity[receiver]) / float64(n.NumMixed)
+}
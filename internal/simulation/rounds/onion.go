@@ -0,0 +1,58 @@
+package rounds
+
+// Onion is a single onion routed through the network, either a message-bearing onion or a checkpoint onion.
+type Onion struct {
+	Path         []int // Path[0] is the sender, Path[1..L] are the relays and Path[L+1] is the receiver
+	IsCheckpoint bool
+	DroppedAt    int          // the first round the onion failed to reach, or 0 if it was delivered
+	Bruises      int          // number of bruises the onion has picked up (see BruiseThreshold)
+	late         map[int]bool // allocated by the first delay, as few onions are ever late
+}
+
+func newOnion(path []int, isCheckpoint bool) *Onion {
+	return &Onion{
+		Path:         path,
+		IsCheckpoint: isCheckpoint,
+	}
+}
+
+// Sender returns the client that created the onion.
+func (o *Onion) Sender() int {
+	return o.Path[0]
+}
+
+// Receiver returns the client the onion is addressed to.
+func (o *Onion) Receiver() int {
+	return o.Path[len(o.Path)-1]
+}
+
+// IsDropped reports whether the onion was lost before reaching its receiver.
+func (o *Onion) IsDropped() bool {
+	return o.DroppedAt > 0
+}
+
+// Reached reports whether the onion arrived at its hop in the given round.
+func (o *Onion) Reached(round int) bool {
+	return !o.IsDropped() || round < o.DroppedAt
+}
+
+// drop marks the onion as lost from the given round on (keeping the earliest round if it was already dropped).
+func (o *Onion) drop(round int) {
+	if !o.IsDropped() || round < o.DroppedAt {
+		o.DroppedAt = round
+	}
+}
+
+// IsLate reports whether the onion was delayed so that it arrived at its hop in the given round after that round's
+// batch had been mixed.
+func (o *Onion) IsLate(round int) bool {
+	return o.late[round]
+}
+
+// delay marks the onion as arriving late at its hop in the given round.
+func (o *Onion) delay(round int) {
+	if o.late == nil {
+		o.late = make(map[int]bool)
+	}
+	o.late[round] = true
+}
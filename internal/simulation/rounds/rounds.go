@@ -5,217 +5,425 @@ import (
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation/rounds/node"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
-	"math/rand"
-	"sync"
 )
 
 type Rounds struct {
-	rounds map[int]map[int]*node.Node
-	P      data.Parameters
-	mu     sync.RWMutex
+	g         *graph
+	P         data.Parameters
+	rng       utils.Rand
+	adversary Adversary
+	traffic   TrafficPattern
+	topology  Topology
+	clientIds []int
+	relayIds  []int
+	onions    []*Onion
+	abortedAt map[int]int     // relay id -> round in which it stopped forwarding
+	weights   map[int]float64 // relay id -> weight in path selection (nil if the relays are unweighted)
+	// messages, corrupted and corruptedClients persist across the epochs of a trial (see NextEpoch)
+	messages         []Message
+	corrupted        []int
+	corruptedClients []int
 }
 
 // helper function to sample from a binomial distribution
-func sampleBinomial(expectedValue int) int {
+func sampleBinomial(rng utils.Rand, expectedValue int) int {
 	value := 0
 	for i := 0; i < expectedValue*2; i++ {
-		if rand.Float64() <= 0.5 {
+		if rng.Intn(2) == 0 {
 			value++
 		}
 	}
 	return value
 }
 
-func SetUpSystem(clientIds, relayIds []int, p data.Parameters) *Rounds {
-	var system = &Rounds{
-		P: p,
+// SetUpSystem builds the routing graph for a single trial of the given scenario (see EstablishPaths), attacked by
+// the adversary named in p.Adversary, with the clients' messages chosen by the traffic pattern named in p.Pattern and
+// routed over the topology named in p.Topology. Every random draw is taken from rng, so the same seed always reproduces
+// the same graph.
+func SetUpSystem(clientIds, relayIds []int, p data.Parameters, scenario int, rng utils.Rand) (*Rounds, error) {
+	adversary, err := NewAdversary(p.Adversary)
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to set up system")
+	}
+	traffic, err := NewTrafficPattern(p.Pattern)
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to set up system")
+	}
+	topology, err := NewTopology(p.Topology, relayIds, p.L)
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to set up system")
+	}
+	if len(p.RelayWeights) > 0 && len(p.RelayWeights) != len(relayIds) {
+		return nil, pl.NewError("failed to set up system: got %d relay weights for %d relays", len(p.RelayWeights), len(relayIds))
+	}
+
+	var system = newRounds(clientIds, relayIds, p, adversary, rng)
+	if err = topology.CheckWeights(system.RelayWeight); err != nil {
+		return nil, pl.WrapError(err, "failed to set up system: invalid relay weights for topology %q", p.Topology)
 	}
+	system.traffic = traffic
+	system.topology = topology
+
+	system.EstablishPaths(clientIds, relayIds, scenario)
+
+	system.corrupted = adversary.Corrupt(system, relayIds)
+
+	system.corruptedClients, err = system.corruptClients()
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to set up system")
+	}
+
+	system.run()
+
+	return system, nil
 
-	system.addClients(clientIds)
+}
+
+// NextEpoch builds the routing graph of the next epoch of the same trial. The clients send the same messages as in r
+// and the adversary keeps the relays and clients it corrupted, but every onion takes a fresh path (and clients send
+// fresh checkpoint onions), drawn from rng.
+func (r *Rounds) NextEpoch(rng utils.Rand) *Rounds {
+	system := newRounds(r.clientIds, r.relayIds, r.P, r.adversary, rng)
+
+	system.traffic = r.traffic
+	system.topology = r.topology
+	system.messages = r.messages
+	system.establishPaths()
 
-	system.addRelays(relayIds)
+	system.corrupted = r.corrupted
+	system.corruptedClients = r.corruptedClients
 
-	system.EstablishPaths(clientIds, relayIds)
+	system.run()
 
 	return system
+}
+
+func newRounds(clientIds, relayIds []int, p data.Parameters, adversary Adversary, rng utils.Rand) *Rounds {
+	var system = &Rounds{
+		P:         p,
+		rng:       rng,
+		adversary: adversary,
+		clientIds: clientIds,
+		relayIds:  relayIds,
+		abortedAt: make(map[int]int),
+		g:         newGraph(clientIds, relayIds, p.L),
+	}
+
+	if len(p.RelayWeights) > 0 {
+		system.weights = make(map[int]float64)
+		for i, relayId := range relayIds {
+			system.weights[relayId] = p.RelayWeights[i]
+		}
+	}
 
+	return system
 }
 
-func (r *Rounds) generatePath(sender, receiver int, relayIds []int) {
+// run corrupts the relays and clients chosen by the adversary, routes the onions and adds the adversary's view of them
+// to the graph.
+func (r *Rounds) run() {
+	r.corrupt(r.corrupted)
+
+	for _, clientId := range r.corruptedClients {
+		r.g.corrupted[r.g.hop(0, clientId)] = true
+		r.g.corrupted[r.g.hop(r.P.L+1, clientId)] = true
+	}
+
+	r.route()
+
+	// every onion passes through at most L+1 links
+	r.g.links = make([]link, 0, len(r.onions)*(r.P.L+1))
+	for _, o := range r.onions {
+		r.EstablishPath(o)
+	}
+}
+
+// route decides the fate of every onion, round by round: first the honest relays of the round verify their
+// checkpoint onions, then every onion is processed by the honest relay holding it or acted on by the adversary.
+func (r *Rounds) route() {
+	verifier := newCheckpointVerifier(r)
+
+	for round := 0; round <= r.P.L; round++ {
+		if round > 0 {
+			verifier.verify(round)
+		}
+		for _, o := range r.onions {
+			if !o.Reached(round) {
+				continue
+			}
+			if round > 0 && !r.IsCorrupted(round, o.Path[round]) {
+				r.processAtHonestRelay(round, o)
+				continue
+			}
+			switch r.adversary.Act(r, round, o) {
+			case Drop:
+				o.drop(round + 1)
+			case Delay:
+				o.delay(round + 1)
+			case Bruise:
+				o.Bruises++
+			case Forward:
+			}
+		}
+	}
+}
+
+// ComputePosterior sets the Probability of every node according to the adversary's posterior.
+func (r *Rounds) ComputePosterior() {
+	r.adversary.Posterior(r)
+}
+
+func (r *Rounds) generatePath(sender, receiver int, isCheckpoint bool) {
 	path := make([]int, r.P.L+2)
 
 	path[0] = sender
 	path[r.P.L+1] = receiver
 
-	for i := 1; i <= r.P.L; i++ {
-		path[i] = utils.RandomElement(relayIds)
-	}
+	r.topology.Path(r, path[1:r.P.L+1])
 
-	r.EstablishPath(path)
+	r.onions = append(r.onions, newOnion(path, isCheckpoint))
 }
 
-func (r *Rounds) EstablishPaths(clientIds, relayIds []int) {
-	messageDestinations := make(map[int]int)
+// EstablishPaths creates the message onions (plus checkpoint onions) of every client. The remaining clients send the
+// messages chosen by the traffic pattern (by default, one each to a random permutation of receivers), while the two
+// target senders each send one message depending on the scenario:
+//   - Scenario 0: C_1 sends to C_R and C_2 sends to C_{R-1}
+//   - Scenario 1: C_1 sends to C_{R-1} and C_2 sends to C_R
+func (r *Rounds) EstablishPaths(clientIds, relayIds []int, scenario int) {
+	r.clientIds = clientIds
+	r.relayIds = relayIds
+
+	if r.traffic == nil {
+		r.traffic = &PermutationPattern{}
+	}
+	if r.topology == nil {
+		r.topology = &FreeRoute{RelayIds: relayIds}
+	}
+	messages := r.traffic.Messages(r, clientIds[2:], clientIds[:len(clientIds)-2])
 
-	for i, receiver := range utils.GetShuffledCopy(clientIds[:len(clientIds)-2]) {
-		messageDestinations[clientIds[i+2]] = receiver
+	if scenario == 0 {
+		messages = append(messages,
+			Message{Sender: clientIds[0], Receiver: clientIds[len(clientIds)-1]},
+			Message{Sender: clientIds[1], Receiver: clientIds[len(clientIds)-2]})
+	} else {
+		messages = append(messages,
+			Message{Sender: clientIds[0], Receiver: clientIds[len(clientIds)-2]},
+			Message{Sender: clientIds[1], Receiver: clientIds[len(clientIds)-1]})
 	}
 
-	messageDestinations[clientIds[0]] = clientIds[len(clientIds)-1]
-	messageDestinations[clientIds[1]] = clientIds[len(clientIds)-2]
+	r.messages = messages
+	r.establishPaths()
+}
+
+// establishPaths creates the message onions of every client, bound for their receivers, along with its checkpoint
+// onions.
+func (r *Rounds) establishPaths() {
+	clientIds := r.clientIds
 
 	expectedToSend := int(((float64(r.P.R) * r.P.ServerLoad) / float64(r.P.C)) - 1.0)
 
-	for sender, receiver := range messageDestinations {
-		r.generatePath(sender, receiver, relayIds)
+	receiversOf := make(map[int][]int)
+	for _, m := range r.messages {
+		receiversOf[m.Sender] = append(receiversOf[m.Sender], m.Receiver)
+	}
+
+	// iterate in client order rather than map order so that the draws below are reproducible
+	for _, sender := range clientIds {
+		for _, receiver := range receiversOf[sender] {
+			r.generatePath(sender, receiver, false)
+		}
 
 		// create checkpoint onion
-		numToSend := sampleBinomial(expectedToSend)
+		numToSend := sampleBinomial(r.rng, expectedToSend)
 
 		receivers := make([]int, numToSend)
 		for i := 0; i < numToSend; i++ {
-			receivers[i] = utils.RandomElement(clientIds)
+			receivers[i] = utils.RandomElementFrom(r.rng, clientIds)
 		}
 
 		for _, checkPointReceiver := range receivers {
-			r.generatePath(sender, checkPointReceiver, relayIds)
+			r.generatePath(sender, checkPointReceiver, true)
 		}
 	}
 }
 
-func (r *Rounds) addRelays(relayIds []int) {
-	numCorrupted := int(r.P.X * float64(r.P.R))
-	corrupted := utils.RandomSubset(relayIds, numCorrupted)
-	isCorrupted := make(map[int]bool)
-	for _, c := range relayIds {
-		isCorrupted[c] = false
-	}
-	for _, c := range corrupted {
-		isCorrupted[c] = true
+// corrupt marks the given relays as corrupted in every round.
+func (r *Rounds) corrupt(relayIds []int) {
+	for _, relayId := range relayIds {
+		for round := 1; round <= r.P.L; round++ {
+			r.g.corrupted[r.g.hop(round, relayId)] = true
+		}
 	}
+}
 
-	for round := 1; round <= r.P.L; round++ {
-		for _, relayId := range relayIds {
-			r.Add(&node.Node{
-				Id:           relayId,
-				Round:        round,
-				ReceivedFrom: make([]*node.Node, 0),
-				SentTo:       make([]*node.Node, 0),
-				IsCorrupted:  isCorrupted[relayId],
-				Probability:  0.0,
-			})
+// corruptClients returns the clients the adversary corrupts: p.CorruptedClients, plus a uniformly random subset of the
+// other clients (except C_1 and C_2) for a total of int(XClients * C).
+func (r *Rounds) corruptClients() ([]int, error) {
+	candidates := r.clientIds[2:]
+	for _, clientId := range r.P.CorruptedClients {
+		if !utils.ContainsElement(candidates, clientId) {
+			return nil, pl.NewError("cannot corrupt client %d (the clients are %d to %d, and C_1 and C_2 stay honest)",
+				clientId, r.clientIds[0], r.clientIds[len(r.clientIds)-1])
 		}
 	}
+	corrupted := utils.RemoveDuplicates(utils.Copy(r.P.CorruptedClients))
+
+	budget := int(r.P.XClients*float64(r.P.C)) - len(corrupted)
+	if budget > 0 {
+		rest := utils.Filter(candidates, func(clientId int) bool {
+			return !utils.ContainsElement(corrupted, clientId)
+		})
+		corrupted = append(corrupted, utils.RandomSubsetFrom(r.rng, rest, budget)...)
+	}
+	return corrupted, nil
 }
 
-func (r *Rounds) addClients(clientIds []int) {
-	for _, clientId := range clientIds {
-		clientSender := &node.Node{
-			Id:           clientId,
-			Round:        0,
-			ReceivedFrom: make([]*node.Node, 0),
-			SentTo:       make([]*node.Node, 0),
-			IsCorrupted:  false,
-			Probability:  0.0,
-		}
+// RelayWeight returns the weight of the given relay in path selection (1 if the relays are unweighted).
+func (r *Rounds) RelayWeight(relayId int) float64 {
+	if r.weights == nil {
+		return 1
+	}
+	return r.weights[relayId]
+}
 
-		clientReceiver := &node.Node{
-			Id:           clientId,
-			Round:        r.P.L + 1,
-			ReceivedFrom: make([]*node.Node, 0),
-			SentTo:       make([]*node.Node, 0),
-			IsCorrupted:  false,
-			Probability:  0.0,
-		}
+// pickRelay draws one of relayIds with probability proportional to its weight.
+func (r *Rounds) pickRelay(relayIds []int) int {
+	if r.weights == nil {
+		return utils.RandomElementFrom(r.rng, relayIds)
+	}
+	return relayIds[utils.RandomWeightedIndexFrom(r.rng, utils.Map(relayIds, r.RelayWeight))]
+}
+
+// CorruptionBudget returns the number of relays the adversary may corrupt.
+func (r *Rounds) CorruptionBudget() int {
+	return int(r.P.X * float64(r.P.R))
+}
+
+// DropTarget returns C_1, the client whose onions the adversary drops.
+func (r *Rounds) DropTarget() int {
+	return r.clientIds[0]
+}
 
-		r.Add(clientSender)
-		r.Add(clientReceiver)
+// Target returns C_2, the client whose message the adversary is trying to locate.
+func (r *Rounds) Target() int {
+	return r.clientIds[1]
+}
+
+// Onions returns every onion of the trial.
+func (r *Rounds) Onions() []*Onion {
+	return r.onions
+}
+
+// isTransparent reports whether the adversary can see through the hop of onion o in the given round, either because
+// the relay is corrupted or because the onion arrived there late and was processed on its own. The sender and
+// receiver are never transparent.
+func (r *Rounds) isTransparent(o *Onion, round int) bool {
+	if round == 0 || round == len(o.Path)-1 {
+		return false
 	}
+	return r.IsCorrupted(round, o.Path[round]) || o.IsLate(round)
 }
 
-func (r *Rounds) Add(n *node.Node) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if r.rounds == nil {
-		r.rounds = make(map[int]map[int]*node.Node)
+// IsTraceable reports whether the adversary can link onion o, as it arrives in the given round, back to its sender,
+// i.e. whether it hasn't been mixed by an honest relay yet.
+func (r *Rounds) IsTraceable(o *Onion, round int) bool {
+	for l := 1; l < round; l++ {
+		if !r.isTransparent(o, l) {
+			return false
+		}
 	}
-	if nodes, present := r.rounds[n.Round]; !present || nodes == nil {
-		r.rounds[n.Round] = make(map[int]*node.Node)
+	return true
+}
+
+// IsCorrupted reports whether the client or relay with the given id is corrupted in the given round.
+func (r *Rounds) IsCorrupted(round, id int) bool {
+	h := r.g.hop(round, id)
+	return h >= 0 && r.g.corrupted[h]
+}
+
+// Add sets the corruption and probability of the hop of n (a client in round 0 or L+1, or a relay in rounds 1 to L)
+// to those of n.
+func (r *Rounds) Add(n *node.Node) {
+	if h := r.g.hop(n.Round, n.Id); h >= 0 {
+		r.g.corrupted[h] = n.IsCorrupted
+		r.g.probability[h] = n.Probability
 	}
-	r.rounds[n.Round][n.Id] = n
 }
 
+// Get returns a snapshot of the hop of the given id in the given round, or nil if there is no such hop. Changes to the
+// snapshot are not reflected in r (see Add).
 func (r *Rounds) Get(round int, id int) *node.Node {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	if r.rounds == nil {
+	h := r.g.hop(round, id)
+	if h < 0 {
 		return nil
 	}
-	if nodes, present := r.rounds[round]; !present || nodes == nil {
-		return nil
-	}
-	if n, present := r.rounds[round][id]; !present {
-		return nil
-	} else {
-		return n
-	}
+	return r.g.nodes([]int{h})[0]
 }
 
+// GetNodes returns snapshots of every hop in the given round, in order of id.
 func (r *Rounds) GetNodes(round int) []*node.Node {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	if r.rounds == nil {
-		return make([]*node.Node, 0)
+	ids := r.g.ids(round)
+	return r.g.nodes(utils.Map(ids, func(id int) int {
+		return r.g.hop(round, id)
+	}))
+}
+
+// excludedFrom returns the first hop of onion o at which the adversary knows that o is not the target message, and so
+// leaves it out of the onions that hop mixed, or len(o.Path) if it never finds out. A corrupted sender reveals every
+// onion it sends (from hop 0), and a corrupted receiver recognizes the checkpoint onions it receives, which excludes
+// them from the last hop that mixed them (the adversary cannot trace them any further back).
+func (r *Rounds) excludedFrom(o *Onion) int {
+	if r.IsCorrupted(0, o.Sender()) {
+		return 0
 	}
-	if nodes, present := r.rounds[round]; !present || nodes == nil {
-		return make([]*node.Node, 0)
+	last := len(o.Path) - 1
+	if o.IsCheckpoint && o.Reached(last) && r.IsCorrupted(last, o.Receiver()) {
+		l := last - 1
+		for r.isTransparent(o, l) {
+			l--
+		}
+		return l
 	}
-	return utils.GetValues(r.rounds[round])
+	return len(o.Path)
 }
 
-func (r *Rounds) EstablishPath(path []int) {
+// EstablishPath adds the adversary's view of an onion to the graph. Every hop that mixed the onion (the sender, honest
+// relays it didn't reach late, and the receiver) counts it as one of the onions it mixed and is linked to the previous
+// and next mixing hops, as the adversary sees through every hop in between. An onion that was dropped or discarded is
+// still counted by the hops that mixed it, but is not linked to any hop it didn't reach. From the hop at which the
+// adversary knows the onion is not the target (see excludedFrom), hops neither count it nor pass it on.
+func (r *Rounds) EstablishPath(o *Onion) {
+	path := o.Path
 
-	if path[0] == 1 {
-		return
-	}
+	excluded := r.excludedFrom(o)
 
-	nodes := utils.Map(utils.NewIntArray(0, len(path)), func(l int) *node.Node {
-		return r.Get(l, path[l])
-	})
-
-	for _, hop := range nodes {
-		if !hop.IsCorrupted {
-			l := hop.Round
-
-			if l-1 > 0 {
-				last := r.Get(l-1, path[l-1])
-				// find last non-corrupted relay
-				for l_ := l - 1; last.IsCorrupted; l_-- {
-					last = r.Get(l_, path[l_])
-				}
-				hop.AddReceivedFrom(last)
+	for l := 0; l < len(path) && l <= excluded; l++ {
+		if r.isTransparent(o, l) || !o.Reached(l) {
+			continue
+		}
+		hop := r.g.hop(l, path[l])
+		if l < excluded {
+			r.g.numMixed[hop]++
+		}
+		if l < excluded && l < len(path)-1 {
+			l_ := l + 1
+			// find next relay that mixes the onion
+			for r.isTransparent(o, l_) {
+				l_++
 			}
-			if l < len(path)-1 {
-				hop.AddSentTo(r.Get(l+1, path[l+1]))
-
-				next := r.Get(l+1, path[l+1])
-				// find next non-corrupted relay
-				for l_ := l + 1; next.IsCorrupted; l_++ {
-					next = r.Get(l_, path[l_])
-				}
-				hop.AddSentTo(next)
+			if o.Reached(l_) {
+				r.g.addLink(hop, r.g.hop(l_, path[l_]))
 			}
 		}
-
 	}
 }
 
 func (r *Rounds) GetProb0() float64 {
-	return r.Get(r.P.L+1, r.P.C-1).Probability
+	return r.g.probability[r.g.hop(r.P.L+1, r.P.C-1)]
 }
 
 func (r *Rounds) GetProb1() float64 {
-	return r.Get(r.P.L+1, r.P.C).Probability
+	return r.g.probability[r.g.hop(r.P.L+1, r.P.C)]
 	//min_ := 1000.0
 	//for i := 1; i <= r.P.C; i++ {
 	//	if r.Get(r.P.L+1, i).Probability < min_ {
@@ -226,34 +434,30 @@ func (r *Rounds) GetProb1() float64 {
 }
 
 func (r *Rounds) GetRatio() float64 {
-	if r.GetProb1() == 0 {
-		if r.GetProb0() == 0 {
-			return 1.0
-		}
-		return 1000.0
-	}
-	return r.GetProb0() / r.GetProb1()
+	return Ratio(r.GetProb0(), r.GetProb1())
 }
 
+// CalculateProbabilities computes the adversary's posterior by propagating the initial probability mass through the
+// graph. Every onion mixed by a node is equally likely to be the target, so a node passes on to each of its next hops
+// the share of its mass given by the fraction of its onions sent there. The mass of onions that were dropped or
+// discarded is lost, so the total mass never grows.
 func (r *Rounds) CalculateProbabilities(initial map[int]float64) {
 	// Calculate probabilities using actual relay paths
 	for clientId, pr := range initial {
-		client := r.Get(0, clientId)
-		client.Probability = pr
+		r.g.probability[r.g.hop(0, clientId)] = pr
 	}
 
-	for round := 0; round <= r.P.L; round++ {
-		nodes := r.GetNodes(round)
-		for _, n := range nodes {
-			if n.Probability == 0 {
-				continue // Skip nodes with zero probability
-			}
-			for _, nextNode := range n.SentTo {
-				if nextNode.Probability+n.Probability/float64(len(n.SentTo)) > 1.000000001 {
-					pl.LogNewError("Probability %f exceeds 1.0", nextNode.Probability+n.Probability/float64(len(n.SentTo)))
-				}
-				nextNode.Probability += n.Probability / float64(len(n.SentTo))
+	// hops are numbered round by round, and every link leads to a later round
+	for h, pr := range r.g.probability {
+		if pr == 0 || r.g.numMixed[h] == 0 {
+			continue // Skip nodes with zero probability
+		}
+		for _, l := range r.g.linksFrom(h) {
+			share := pr * (float64(l.count) / float64(r.g.numMixed[h]))
+			if r.g.probability[l.to]+share > 1.000000001 {
+				pl.LogNewError("Probability %f exceeds 1.0", r.g.probability[l.to]+share)
 			}
+			r.g.probability[l.to] += share
 		}
 	}
 }
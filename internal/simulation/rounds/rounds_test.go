@@ -0,0 +1,317 @@
+package rounds
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestCalculateProbabilities_ConservesMass(t *testing.T) {
+	for _, x := range []float64{0.0, 0.5} {
+		p := data.Parameters{C: 50, R: 10, X: x, ServerLoad: 20, L: 5}
+		clientIds := utils.NewIntArray(1, p.C+1)
+		relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(3)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		system.ComputePosterior()
+
+		total := 0.0
+		for _, receiver := range system.GetNodes(p.L + 1) {
+			total += receiver.Probability
+		}
+		// the default adversary never drops C_2's onions, so all of the mass must reach the receivers
+		if total < 1.0-1e-9 || total > 1.0+1e-9 {
+			t.Fatalf("X=%f: expected the receivers to hold all of the probability mass, got %f", x, total)
+		}
+	}
+}
+
+func TestRoundRatios_EndsWithFinalRatio(t *testing.T) {
+	p := data.Parameters{C: 50, R: 10, X: 0.3, ServerLoad: 20, L: 5}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	for seed := int64(0); seed < 20; seed++ {
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(seed)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		system.ComputePosterior()
+
+		ratios := system.RoundRatios()
+		if len(ratios) != p.L+2 {
+			t.Fatalf("Expected %d ratios, got %d", p.L+2, len(ratios))
+		}
+		final := ratios[len(ratios)-1]
+		if math.Abs(final-system.GetRatio()) > 1e-9*system.GetRatio() {
+			t.Fatalf("Seed %d: expected the last round ratio %f to equal the final ratio %f", seed, final, system.GetRatio())
+		}
+	}
+}
+
+func TestTrafficPatterns_MessageCounts(t *testing.T) {
+	p := data.Parameters{C: 30, R: 5, X: 0, ServerLoad: 20, L: 3}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	// the number of messages sent, including the two sent by C_1 and C_2
+	expected := map[string]int{
+		"":         p.C,
+		"zipf:2":   p.C,
+		"group:4":  7*4*3 + 2, // the 28 background clients form 7 groups of 4
+		"silent":   p.C - 14,
+		"k:3":      3*(p.C-2) + 2,
+		"silent:0": p.C,
+	}
+	for pattern, numMessages := range expected {
+		p.Pattern = pattern
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(5)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		messages := utils.Filter(system.Onions(), func(o *Onion) bool {
+			return !o.IsCheckpoint
+		})
+		if len(messages) != numMessages {
+			t.Fatalf("Pattern %q: expected %d messages, got %d", pattern, numMessages, len(messages))
+		}
+		for _, o := range messages {
+			// only the permutation patterns may pick the sender as its own receiver
+			if o.Sender() == o.Receiver() && pattern != "" && !strings.HasPrefix(pattern, "silent") {
+				t.Fatalf("Pattern %q: client %d sent a message to itself", pattern, o.Sender())
+			}
+		}
+	}
+
+	p.Pattern = "unknown"
+	if _, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(5))); err == nil {
+		t.Fatalf("Expected an error for an unknown pattern")
+	}
+}
+
+func TestZipfPattern_NeverSendsToSender(t *testing.T) {
+	// with S=2000, every receiver but the first has weight 0, so the first receiver has no one to send to by weight
+	r := &Rounds{rng: rand.New(rand.NewSource(1))}
+	for _, receivers := range [][]int{{1, 2, 3}, {1}} {
+		for _, m := range (&ZipfPattern{S: 2000}).Messages(r, []int{1, 2, 3}, receivers) {
+			if m.Sender == m.Receiver {
+				t.Fatalf("Receivers %v: client %d sent a message to itself", receivers, m.Sender)
+			}
+			if m.Sender != 1 && m.Receiver != 1 {
+				t.Fatalf("Receivers %v: expected client %d to send to the first receiver, got %d", receivers, m.Sender, m.Receiver)
+			}
+		}
+	}
+}
+
+func TestCorruptedReceivers_RevealScenario(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0, ServerLoad: 20, L: 3, CorruptedClients: []int{19, 20}}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	// C_1's message is dropped, so whichever of C_{R-1} and C_R it was bound for receives no message at all
+	for scenario, expected := range []float64{1000, 0} {
+		system, err := SetUpSystem(clientIds, relayIds, p, scenario, rand.New(rand.NewSource(11)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		system.ComputePosterior()
+		if system.GetRatio() != expected {
+			t.Fatalf("Scenario %d: expected ratio %f, got %f", scenario, expected, system.GetRatio())
+		}
+	}
+
+	p.CorruptedClients = []int{2}
+	if _, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(11))); err == nil {
+		t.Fatalf("Expected an error when corrupting C_2")
+	}
+}
+
+func TestTopologies_RestrictPaths(t *testing.T) {
+	p := data.Parameters{C: 20, R: 12, X: 0, ServerLoad: 10, L: 3}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	// allowed returns the relays onions may visit in each round
+	allowed := map[string]func(o *Onion) [][]int{
+		"stratified": func(o *Onion) [][]int {
+			return [][]int{relayIds[0:4], relayIds[4:8], relayIds[8:12]}
+		},
+		"cascade:2": func(o *Onion) [][]int {
+			// the first relay fixes the cascade
+			if o.Path[1] == relayIds[0] {
+				return [][]int{relayIds[0:1], relayIds[1:2], relayIds[2:3]}
+			}
+			return [][]int{relayIds[3:4], relayIds[4:5], relayIds[5:6]}
+		},
+		"mixers:2": func(o *Onion) [][]int {
+			return [][]int{relayIds[0:8], relayIds[0:8], relayIds[8:12]}
+		},
+	}
+	for topology, allowedFor := range allowed {
+		p.Topology = topology
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(2)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for _, o := range system.Onions() {
+			for l, relays := range allowedFor(o) {
+				if !utils.ContainsElement(relays, o.Path[l+1]) {
+					t.Fatalf("Topology %q: onion visited relay %d in round %d, expected one of %v", topology, o.Path[l+1], l+1, relays)
+				}
+			}
+		}
+	}
+
+	for _, topology := range []string{"unknown", "cascade:5", "mixers:4"} {
+		p.Topology = topology
+		if _, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(2))); err == nil {
+			t.Fatalf("Expected an error for topology %q", topology)
+		}
+	}
+}
+
+func TestRelayWeights_BiasPathsAndCorruption(t *testing.T) {
+	p := data.Parameters{C: 40, R: 4, X: 0.25, ServerLoad: 20, L: 3, Adversary: "weighted", RelayWeights: []float64{1, 1, 6, 0}}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(4)))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	visits := make(map[int]int)
+	total := 0
+	for _, o := range system.Onions() {
+		for _, relayId := range o.Path[1 : len(o.Path)-1] {
+			visits[relayId]++
+			total++
+		}
+	}
+	if visits[relayIds[3]] != 0 {
+		t.Fatalf("Expected no onion to visit a relay of weight 0, got %d visits", visits[relayIds[3]])
+	}
+	if share := float64(visits[relayIds[2]]) / float64(total); math.Abs(share-0.75) > 0.05 {
+		t.Fatalf("Expected the heaviest relay to get 75%% of the hops, got %.1f%%", share*100)
+	}
+	if !system.Get(1, relayIds[2]).IsCorrupted || system.Get(1, relayIds[0]).IsCorrupted || system.Get(1, relayIds[1]).IsCorrupted {
+		t.Fatalf("Expected the weighted adversary to corrupt only the heaviest relay")
+	}
+
+	p.RelayWeights = []float64{1, 1}
+	if _, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(4))); err == nil {
+		t.Fatalf("Expected an error for the wrong number of weights")
+	}
+
+	// every set of relays a hop is drawn from needs some weight, not just the relays as a whole
+	for topology, weights := range map[string][]float64{
+		"free":       {0, 0, 0, 0},
+		"stratified": {1, 1, 1, 0}, // layers {1}, {2}, {3, 4} with L=3: fine
+		"cascade:2":  {1, 0, 0, 1}, // cascades {1, 2} and {3, 4}, L=2
+		"mixers:1":   {1, 1, 0, 0}, // mixers {1, 2}, gatekeepers {3, 4}
+	} {
+		p := data.Parameters{C: 40, R: 4, X: 0.25, ServerLoad: 20, L: 3, Topology: topology, RelayWeights: weights}
+		if topology == "cascade:2" || topology == "mixers:1" {
+			p.L = 2
+		}
+		_, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(4)))
+		if expectError := topology != "stratified"; (err != nil) != expectError {
+			t.Fatalf("Topology %q with weights %v: expected an error: %v, got %v", topology, weights, expectError, err)
+		}
+	}
+	p = data.Parameters{C: 40, R: 4, X: 0.25, ServerLoad: 20, L: 2, Topology: "stratified", RelayWeights: []float64{1, 1, 0, 0}}
+	if _, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(4))); err == nil {
+		t.Fatalf("Expected an error for a stratified layer of weight 0")
+	}
+}
+
+func TestCheckpointVerifier_AbortsAboveThresholdAndCascades(t *testing.T) {
+	// no relay is corrupted, so the only onions that go missing are C_1's (dropped by the adversary before the first
+	// relay) and those held by relays that aborted
+	p := data.Parameters{C: 10, R: 3, X: 0, ServerLoad: 20, L: 4, T: 2}
+	clientIds := utils.NewIntArray(1, p.C+1)
+	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
+
+	cascaded := false
+	for seed := int64(0); seed < 20; seed++ {
+		system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(seed)))
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		abortedBy := func(relayId, round int) bool {
+			a, aborted := system.abortedAt[relayId]
+			return aborted && a <= round
+		}
+		reached := func(o *Onion, round int) bool {
+			if o.Sender() == system.DropTarget() {
+				return false
+			}
+			for l := 1; l < round; l++ {
+				if abortedBy(o.Path[l], l) {
+					return false
+				}
+			}
+			return true
+		}
+		// missing returns the checkpoint onions that failed to reach the relay up to the given round, while it was
+		// still forwarding
+		missing := func(relayId, round int) int {
+			count := 0
+			for l := 1; l <= round; l++ {
+				if abortedBy(relayId, l-1) {
+					break
+				}
+				for _, o := range system.Onions() {
+					if o.IsCheckpoint && o.Path[l] == relayId && !reached(o, l) {
+						count++
+					}
+				}
+			}
+			return count
+		}
+
+		for _, relayId := range relayIds {
+			a, aborted := system.abortedAt[relayId]
+			if !aborted {
+				if n := missing(relayId, p.L); n > p.T {
+					t.Fatalf("Seed %d: relay %d missed %d checkpoint onions but didn't abort", seed, relayId, n)
+				}
+				continue
+			}
+			if n := missing(relayId, a); n <= p.T {
+				t.Fatalf("Seed %d: relay %d aborted in round %d after missing only %d checkpoint onions", seed, relayId, a, n)
+			}
+			if n := missing(relayId, a-1); n > p.T {
+				t.Fatalf("Seed %d: relay %d missed %d checkpoint onions by round %d but only aborted in round %d", seed, relayId, n, a-1, a)
+			}
+			cascaded = cascaded || a > 1
+		}
+		for _, o := range system.Onions() {
+			for l := 1; l <= p.L+1; l++ {
+				if o.Reached(l) != reached(o, l) {
+					t.Fatalf("Seed %d: expected an onion with path %v to reach round %d: %v", seed, o.Path, l, reached(o, l))
+				}
+			}
+		}
+	}
+	if !cascaded {
+		t.Fatalf("Expected the aborts to cascade to a later round for some seed")
+	}
+
+	p.T = 0
+	system, err := SetUpSystem(clientIds, relayIds, p, 0, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if system.NumAborted() != 0 {
+		t.Fatalf("Expected no aborts without a threshold, got %d", system.NumAborted())
+	}
+}
@@ -0,0 +1,197 @@
+package rounds
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Topology decides which relays an onion may visit in each round. Among those, relays are picked in proportion to their
+// weight (see Rounds.RelayWeight).
+type Topology interface {
+	// Path sets hops to the relays of the L rounds of a new onion's path. Every draw must be taken from r.rng.
+	Path(r *Rounds, hops []int)
+	// CheckWeights returns an error if, with the given relay weights, some set of relays the topology draws a hop from
+	// has total weight 0 (the draw would be undefined).
+	CheckWeights(weight func(relayId int) float64) error
+}
+
+// topologies maps the name of every topology to a constructor taking the relays, the number of rounds and the
+// topology's argument ("" if none was given, in which case the constructor picks a default).
+var topologies = map[string]func(relayIds []int, L int, arg string) (Topology, error){
+	"free": func(relayIds []int, L int, arg string) (Topology, error) {
+		return &FreeRoute{RelayIds: relayIds}, nil
+	},
+	"stratified": func(relayIds []int, L int, arg string) (Topology, error) {
+		if len(relayIds) < L {
+			return nil, pl.NewError("a stratified topology needs at least one relay per round (R=%d, L=%d)", len(relayIds), L)
+		}
+		return &Stratified{Layers: split(relayIds, L)}, nil
+	},
+	"cascade": func(relayIds []int, L int, arg string) (Topology, error) {
+		numCascades, err := parseIntArg(arg, len(relayIds)/utils.Max(L, 1))
+		if err != nil {
+			return nil, err
+		}
+		if numCascades < 1 || numCascades*L > len(relayIds) {
+			return nil, pl.NewError("cannot form %d cascades of %d relays from %d relays", numCascades, L, len(relayIds))
+		}
+		cascades := make([][]int, numCascades)
+		for i := range cascades {
+			cascades[i] = relayIds[i*L : (i+1)*L]
+		}
+		return &Cascade{Cascades: cascades}, nil
+	},
+	"mixers": func(relayIds []int, L int, arg string) (Topology, error) {
+		l1, err := parseIntArg(arg, (L+1)/2)
+		if err != nil {
+			return nil, err
+		}
+		if l1 < 1 || l1 > L {
+			return nil, pl.NewError("the number of mixing rounds must be between 1 and L=%d, got %d", L, l1)
+		}
+		if l1 == L {
+			return &Mixers{L1: l1, Mixers: relayIds}, nil
+		}
+		if len(relayIds) < 2 {
+			return nil, pl.NewError("mixers and gatekeepers need at least 2 relays, got %d", len(relayIds))
+		}
+		// split the relays in proportion to the rounds they serve, so that every relay has the same expected load
+		numMixers := int(math.Round(float64(len(relayIds)*l1) / float64(L)))
+		numMixers = utils.Min(utils.Max(numMixers, 1), len(relayIds)-1)
+		return &Mixers{L1: l1, Mixers: relayIds[:numMixers], Gatekeepers: relayIds[numMixers:]}, nil
+	},
+}
+
+// NewTopology returns the topology described by spec over the given relays, which is the name of a topology optionally
+// followed by a colon and its argument (e.g. "cascade:2"). "" selects the free-route topology.
+func NewTopology(spec string, relayIds []int, L int) (Topology, error) {
+	if spec == "" {
+		spec = "free"
+	}
+	name, arg, _ := strings.Cut(spec, ":")
+	if newTopology, present := topologies[name]; present {
+		topology, err := newTopology(relayIds, L, arg)
+		if err != nil {
+			return nil, pl.WrapError(err, "invalid topology %q", spec)
+		}
+		return topology, nil
+	}
+	return nil, pl.NewError("unknown topology %q (expected one of %v)", spec, TopologyNames())
+}
+
+// TopologyNames returns the names accepted by NewTopology.
+func TopologyNames() []string {
+	names := utils.GetKeys(topologies)
+	sort.Strings(names)
+	return names
+}
+
+// split divides ids into n contiguous groups whose sizes differ by at most one.
+func split(ids []int, n int) [][]int {
+	groups := make([][]int, n)
+	for i := range groups {
+		groups[i] = ids[i*len(ids)/n : (i+1)*len(ids)/n]
+	}
+	return groups
+}
+
+// positive reports whether some relay of relayIds has a positive weight.
+func positive(relayIds []int, weight func(relayId int) float64) bool {
+	return utils.Sum(utils.Map(relayIds, weight)) > 0
+}
+
+// FreeRoute lets every hop be any relay, drawn with replacement.
+type FreeRoute struct {
+	RelayIds []int
+}
+
+func (t *FreeRoute) Path(r *Rounds, hops []int) {
+	for i := range hops {
+		hops[i] = r.pickRelay(t.RelayIds)
+	}
+}
+
+func (t *FreeRoute) CheckWeights(weight func(relayId int) float64) error {
+	if !positive(t.RelayIds, weight) {
+		return pl.NewError("every relay has weight 0")
+	}
+	return nil
+}
+
+// Stratified splits the relays into one layer per round (as in Stadium), and draws the hop of round l from layer l.
+type Stratified struct {
+	Layers [][]int
+}
+
+func (t *Stratified) Path(r *Rounds, hops []int) {
+	for i, layer := range t.Layers {
+		hops[i] = r.pickRelay(layer)
+	}
+}
+
+func (t *Stratified) CheckWeights(weight func(relayId int) float64) error {
+	for i, layer := range t.Layers {
+		if !positive(layer, weight) {
+			return pl.NewError("every relay of layer %d (%v) has weight 0", i+1, layer)
+		}
+	}
+	return nil
+}
+
+// Cascade groups the relays into fixed chains of L relays (as in Vuvuzela, which uses a single chain), and sends every
+// onion through a random chain. With weighted relays, a chain is picked in proportion to the weight of its lightest
+// relay, its bottleneck.
+type Cascade struct {
+	Cascades [][]int
+}
+
+func (t *Cascade) Path(r *Rounds, hops []int) {
+	if r.weights == nil {
+		copy(hops, utils.RandomElementFrom(r.rng, t.Cascades))
+		return
+	}
+	bottlenecks := utils.Map(t.Cascades, func(cascade []int) float64 {
+		return utils.MinOver(utils.Map(cascade, r.RelayWeight))
+	})
+	copy(hops, t.Cascades[utils.RandomWeightedIndexFrom(r.rng, bottlenecks)])
+}
+
+func (t *Cascade) CheckWeights(weight func(relayId int) float64) error {
+	for _, cascade := range t.Cascades {
+		if utils.MinOver(utils.Map(cascade, weight)) > 0 {
+			return nil
+		}
+	}
+	return pl.NewError("every cascade has a relay of weight 0")
+}
+
+// Mixers routes every onion through L1 mixers followed by L-L1 gatekeepers (see Figure 1 of the README). Each hop is
+// drawn from its set of relays; with L1 = L, this is the free-route topology.
+type Mixers struct {
+	L1          int
+	Mixers      []int
+	Gatekeepers []int
+}
+
+func (t *Mixers) Path(r *Rounds, hops []int) {
+	for i := range hops {
+		if i < t.L1 {
+			hops[i] = r.pickRelay(t.Mixers)
+		} else {
+			hops[i] = r.pickRelay(t.Gatekeepers)
+		}
+	}
+}
+
+func (t *Mixers) CheckWeights(weight func(relayId int) float64) error {
+	if !positive(t.Mixers, weight) {
+		return pl.NewError("every mixer has weight 0")
+	}
+	if len(t.Gatekeepers) > 0 && !positive(t.Gatekeepers, weight) {
+		return pl.NewError("every gatekeeper has weight 0")
+	}
+	return nil
+}
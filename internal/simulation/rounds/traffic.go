@@ -0,0 +1,208 @@
+package rounds
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Message is a message sent from one client to another in an epoch.
+type Message struct {
+	Sender, Receiver int
+}
+
+// TrafficPattern decides which messages the background clients (every client but the targets C_1 and C_2, whose
+// messages are fixed by the scenario) send. Every client sends its checkpoint onions regardless of its messages.
+type TrafficPattern interface {
+	// Messages returns the messages of the given background senders, in any number. receivers are the clients that
+	// receive no message from C_1 or C_2, which patterns address unless stated otherwise. Every draw must be taken
+	// from r.rng.
+	Messages(r *Rounds, senders, receivers []int) []Message
+}
+
+// trafficPatterns maps the name of every pattern to a constructor taking the pattern's argument ("" if none was
+// given, in which case the constructor picks a default).
+var trafficPatterns = map[string]func(arg string) (TrafficPattern, error){
+	"permutation": func(arg string) (TrafficPattern, error) {
+		return &PermutationPattern{}, nil
+	},
+	"zipf": func(arg string) (TrafficPattern, error) {
+		s, err := parseFloatArg(arg, 1)
+		return &ZipfPattern{S: s}, err
+	},
+	"group": func(arg string) (TrafficPattern, error) {
+		size, err := parseIntArg(arg, 3)
+		return &GroupPattern{Size: size}, err
+	},
+	"silent": func(arg string) (TrafficPattern, error) {
+		fraction, err := parseFloatArg(arg, 0.5)
+		if err == nil && fraction > 1 {
+			err = pl.NewError("fraction %f exceeds 1", fraction)
+		}
+		return &SilentPattern{Fraction: fraction}, err
+	},
+	"k": func(arg string) (TrafficPattern, error) {
+		k, err := parseIntArg(arg, 2)
+		return &KMessagesPattern{K: k}, err
+	},
+}
+
+// NewTrafficPattern returns the traffic pattern described by spec, which is the name of a pattern optionally followed by
+// a colon and its argument (e.g. "zipf:1.5"). "" selects the permutation pattern.
+func NewTrafficPattern(spec string) (TrafficPattern, error) {
+	if spec == "" {
+		spec = "permutation"
+	}
+	name, arg, _ := strings.Cut(spec, ":")
+	if newPattern, present := trafficPatterns[name]; present {
+		pattern, err := newPattern(arg)
+		if err != nil {
+			return nil, pl.WrapError(err, "invalid traffic pattern %q", spec)
+		}
+		return pattern, nil
+	}
+	return nil, pl.NewError("unknown traffic pattern %q (expected one of %v)", spec, TrafficPatternNames())
+}
+
+// TrafficPatternNames returns the names accepted by NewTrafficPattern.
+func TrafficPatternNames() []string {
+	names := utils.GetKeys(trafficPatterns)
+	sort.Strings(names)
+	return names
+}
+
+// parseIntArg parses a non-negative integer argument, returning defaultValue if arg is empty.
+func parseIntArg(arg string, defaultValue int) (int, error) {
+	if arg == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(arg)
+	if err != nil || value < 0 {
+		return defaultValue, pl.NewError("invalid argument %q", arg)
+	}
+	return value, nil
+}
+
+// parseFloatArg parses a non-negative argument, returning defaultValue if arg is empty.
+func parseFloatArg(arg string, defaultValue float64) (float64, error) {
+	if arg == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil || value < 0 {
+		return defaultValue, pl.NewError("invalid argument %q", arg)
+	}
+	return value, nil
+}
+
+// PermutationPattern is the idealized workload: every background client sends one message, and the receivers are a
+// random permutation of receivers. As C_1 and C_2 send to the other two clients, every client receives exactly one
+// message.
+type PermutationPattern struct{}
+
+func (t *PermutationPattern) Messages(r *Rounds, senders, receivers []int) []Message {
+	messages := make([]Message, len(senders))
+	for i, receiver := range utils.GetShuffledCopyFrom(r.rng, receivers) {
+		messages[i] = Message{Sender: senders[i], Receiver: receiver}
+	}
+	return messages
+}
+
+// ZipfPattern models popular receivers: every background client sends one message to a receiver drawn from a Zipf
+// distribution with exponent S, where the receiver of rank k (in client order) is chosen with probability ∝ 1/k^S.
+// Clients never send to themselves (a sender that is the only receiver sends nothing).
+type ZipfPattern struct {
+	S float64
+}
+
+func (t *ZipfPattern) Messages(r *Rounds, senders, receivers []int) []Message {
+	weights := make([]float64, len(receivers))
+	for k := range weights {
+		weights[k] = 1 / math.Pow(float64(k+1), t.S)
+	}
+	messages := make([]Message, 0, len(senders))
+	for _, sender := range senders {
+		senderWeights := make([]float64, len(receivers))
+		for k, receiver := range receivers {
+			if receiver != sender {
+				senderWeights[k] = weights[k]
+			}
+		}
+		var receiver int
+		if utils.Sum(senderWeights) > 0 {
+			receiver = receivers[utils.RandomWeightedIndexFrom(r.rng, senderWeights)]
+		} else {
+			// with a large S, the weight of every receiver but the sender can round to 0
+			others := utils.Filter(receivers, func(receiver int) bool { return receiver != sender })
+			if len(others) == 0 {
+				continue
+			}
+			receiver = utils.RandomElementFrom(r.rng, others)
+		}
+		messages = append(messages, Message{Sender: sender, Receiver: receiver})
+	}
+	return messages
+}
+
+// GroupPattern models group chats: the background clients are split at random into groups of Size clients, and every
+// client sends one message to each other member of its group. Unlike the other patterns, the members (and so the
+// receivers) are the background senders, which include the clients C_1 and C_2 send to.
+type GroupPattern struct {
+	Size int
+}
+
+func (t *GroupPattern) Messages(r *Rounds, senders, receivers []int) []Message {
+	size := utils.Max(t.Size, 1)
+	shuffled := utils.GetShuffledCopyFrom(r.rng, senders)
+	messages := make([]Message, 0)
+	for start := 0; start < len(shuffled); start += size {
+		group := shuffled[start:utils.Min(start+size, len(shuffled))]
+		for _, sender := range group {
+			for _, receiver := range group {
+				if sender != receiver {
+					messages = append(messages, Message{Sender: sender, Receiver: receiver})
+				}
+			}
+		}
+	}
+	return messages
+}
+
+// SilentPattern models idle clients: a random Fraction of the background clients sends no message (only checkpoint
+// onions), and the others send one message each to distinct random receivers.
+type SilentPattern struct {
+	Fraction float64
+}
+
+func (t *SilentPattern) Messages(r *Rounds, senders, receivers []int) []Message {
+	numActive := len(senders) - int(t.Fraction*float64(len(senders)))
+	active := utils.RandomSubsetFrom(r.rng, senders, numActive)
+	sort.Ints(active)
+	messages := make([]Message, 0, len(active))
+	for i, receiver := range utils.RandomSubsetFrom(r.rng, receivers, len(active)) {
+		messages = append(messages, Message{Sender: active[i], Receiver: receiver})
+	}
+	return messages
+}
+
+// KMessagesPattern models chatty clients: every background client sends K messages, to K distinct random receivers
+// other than itself.
+type KMessagesPattern struct {
+	K int
+}
+
+func (t *KMessagesPattern) Messages(r *Rounds, senders, receivers []int) []Message {
+	messages := make([]Message, 0, len(senders)*t.K)
+	for _, sender := range senders {
+		others := utils.Filter(receivers, func(receiver int) bool {
+			return receiver != sender
+		})
+		for _, receiver := range utils.RandomSubsetFrom(r.rng, others, t.K) {
+			messages = append(messages, Message{Sender: sender, Receiver: receiver})
+		}
+	}
+	return messages
+}
@@ -1,51 +1,168 @@
 package simulation
 
 import (
+	pl "github.com/HannahMarsh/PrettyLogger"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation/rounds"
 	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils/executor"
+	"math/rand"
+	"runtime"
+	"time"
 )
 
-func createGraph(p data.Parameters) *rounds.Rounds {
+// TrialSeed returns the seed used for trial i of a run started with the given base seed.
+func TrialSeed(seed int64, i int) int64 {
+	return seed + int64(i)
+}
+
+func createGraph(p data.Parameters, scenario int, rng utils.Rand) (*rounds.Rounds, error) {
 	clientIds := utils.NewIntArray(1, p.C+1)
 	relayIds := utils.NewIntArray(p.C+1, p.C+1+p.R)
 
-	system := rounds.SetUpSystem(clientIds, relayIds, p)
+	system, err := rounds.SetUpSystem(clientIds, relayIds, p, scenario, rng)
+	if err != nil {
+		return nil, err
+	}
 
-	//slog.Info("here")
+	system.ComputePosterior()
 
-	initial := make(map[int]float64)
-	for _, clientId := range clientIds {
-		initial[clientId] = 0.0
-	}
-	initial[clientIds[1]] = 1.0
+	return system, nil
+}
 
-	system.CalculateProbabilities(initial)
+// trial holds the adversary's view of both scenarios of a single trial.
+type trial struct {
+	pr0, pr1, ratios [2]float64
+	aborted          [2]int
+	roundRatios      [2][]float64
+	epochRatios      [2][]float64
+}
+
+func runTrial(p data.Parameters, seed int64) (*trial, error) {
+	t := &trial{}
+	for scenario := 0; scenario < 2; scenario++ {
+		rng := rand.New(rand.NewSource(seed))
+		system, err := createGraph(p, scenario, rng)
+		if err != nil {
+			return nil, err
+		}
+		if p.Epochs <= 1 {
+			t.pr0[scenario] = system.GetProb0()
+			t.pr1[scenario] = system.GetProb1()
+			t.ratios[scenario] = system.GetRatio()
+			t.aborted[scenario] = system.NumAborted()
+			t.roundRatios[scenario] = system.RoundRatios()
+			continue
+		}
+
+		observations := newIntersection()
+		for epoch := 0; epoch < p.Epochs; epoch++ {
+			if epoch > 0 {
+				system = system.NextEpoch(rng)
+				system.ComputePosterior()
+			}
+			observations.add(system)
+			t.pr0[scenario], t.pr1[scenario] = observations.probabilities(p.C-1, p.C)
+			t.ratios[scenario] = rounds.Ratio(t.pr0[scenario], t.pr1[scenario])
+			t.aborted[scenario] += system.NumAborted()
+			t.epochRatios[scenario] = append(t.epochRatios[scenario], t.ratios[scenario])
+		}
+	}
+	return t, nil
+}
 
-	return system
+// Run executes numRuns independent trials, each of which runs both Scenario 0 and Scenario 1 and records the
+// adversary's view of each. With p.Epochs > 1, every trial runs that many epochs, and the view is the one after
+// intersecting the observations of all of them, whose probabilities are normalized (unlike those of a single epoch, see
+// data.View). Trial i draws all of its randomness from TrialSeed(seed, i), so any single trial can be replayed by
+// calling Run with that seed and numRuns = 1.
+//
+// Up to workers trials (runtime.NumCPU() if workers <= 0) run in parallel on a worker pool. Results are always
+// recorded in trial order, so the output doesn't depend on the number of workers.
+func Run(p data.Parameters, numRuns int, seed int64, workers int) (*data.Result, error) {
+	return RunStreaming(p, numRuns, seed, workers, nil)
 }
 
-func Run(p data.Parameters, numRuns int) *data.Result {
-	P0 := make([]float64, numRuns)
-	P1 := make([]float64, numRuns)
-	ratios := make([]float64, numRuns)
+// RunStreaming is Run, but also calls onTrial (unless nil) with every trial as soon as it and all the trials before it
+// are done, in trial order. If onTrial fails, no further trials are run.
+func RunStreaming(p data.Parameters, numRuns int, seed int64, workers int, onTrial func(data.Trial) error) (*data.Result, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	started := time.Now()
+
+	views := [2]data.View{}
+	for scenario := range views {
+		views[scenario] = data.View{
+			Pr0:     make([]float64, numRuns),
+			Pr1:     make([]float64, numRuns),
+			Ratios:  make([]float64, numRuns),
+			Aborted: make([]int, numRuns),
+		}
+		if p.Epochs > 1 {
+			views[scenario].EpochRatios = make([][]float64, numRuns)
+		} else {
+			views[scenario].RoundRatios = make([][]float64, numRuns)
+		}
+	}
+	seeds := make([]int64, numRuns)
+
+	pool := executor.NewWorkerPoolWithMax(workers)
+	defer pool.Stop()
+
+	futures := make([]*executor.Future[*trial], numRuns)
+	submit := func(index int) {
+		seeds[index] = TrialSeed(seed, index)
+		futures[index] = executor.SubmitWithError(pool, nil, func() (*trial, error) {
+			return runTrial(p, seeds[index])
+		})
+	}
+
+	// keep at most workers trials in flight, so that memory use doesn't grow with numRuns
+	for i := 0; i < numRuns && i < workers; i++ {
+		submit(i)
+	}
 
 	for i := 0; i < numRuns; i++ {
 
 		index := i
 
-		system := createGraph(p)
+		t, err := futures[index].Get()
+		if err != nil {
+			return nil, pl.WrapError(err, "failed to run trial %d", index)
+		}
+		futures[index] = nil
 
-		P0[index] = system.GetProb0()
-		P1[index] = system.GetProb1()
-		ratios[index] = system.GetRatio()
+		if index+workers < numRuns {
+			submit(index + workers)
+		}
 
+		for scenario, view := range views {
+			view.Pr0[index] = t.pr0[scenario]
+			view.Pr1[index] = t.pr1[scenario]
+			view.Ratios[index] = t.ratios[scenario]
+			view.Aborted[index] = t.aborted[scenario]
+			if p.Epochs > 1 {
+				view.EpochRatios[index] = t.epochRatios[scenario]
+			} else {
+				view.RoundRatios[index] = t.roundRatios[scenario]
+			}
+		}
+
+		if onTrial != nil {
+			v := data.Result{Version: data.SchemaVersion, P: p, View: views[0], Seeds: seeds, Scenario1: views[1]}
+			if err = onTrial(v.Trial(index)); err != nil {
+				return nil, pl.WrapError(err, "failed to handle trial %d", index)
+			}
+		}
 	}
 
 	return &data.Result{
-		P:      p,
-		Pr0:    P0,
-		Pr1:    P1,
-		Ratios: ratios,
-	}
+		Version:   data.SchemaVersion,
+		P:         p,
+		View:      views[0],
+		Seeds:     seeds,
+		Scenario1: views[1],
+		Batches:   []data.Batch{data.NewBatch(numRuns, seed, workers, started)},
+	}, nil
 }
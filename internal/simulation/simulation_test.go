@@ -0,0 +1,153 @@
+package simulation
+
+import (
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/simulation/rounds"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRun_SameSeedReproducesTrials(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+
+	a, err := Run(p, 5, 42, 1)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	b, err := Run(p, 5, 42, 4)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for i := range a.Ratios {
+		if a.Pr0[i] != b.Pr0[i] || a.Pr1[i] != b.Pr1[i] || a.Ratios[i] != b.Ratios[i] {
+			t.Fatalf("Trial %d differs between sequential and parallel runs with the same seed", i)
+		}
+	}
+
+	// replaying a single trial from its recorded seed gives the same result
+	replay, err := Run(p, 1, a.Seeds[3], 1)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if replay.Ratios[0] != a.Ratios[3] {
+		t.Fatalf("Expected replayed ratio %f, got %f", a.Ratios[3], replay.Ratios[0])
+	}
+}
+
+func TestRunStreaming_EmitsTrialsInOrder(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+
+	trials := make([]data.Trial, 0)
+	v, err := RunStreaming(p, 6, 42, 3, func(trial data.Trial) error {
+		trials = append(trials, trial)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if len(trials) != 6 {
+		t.Fatalf("Expected 6 trials, got %d", len(trials))
+	}
+	for i, trial := range trials {
+		if trial.Index != i || trial.Seed != v.Seeds[i] || trial.Key != p.Key() {
+			t.Fatalf("Trial %d was emitted as trial %d with seed %d and key %s", i, trial.Index, trial.Seed, trial.Key)
+		}
+		if trial.Ratio != v.Ratios[i] || trial.Scenario1.Ratio != v.Scenario1.Ratios[i] || len(trial.RoundRatios) != p.L+2 {
+			t.Fatalf("Trial %d differs from the recorded result", i)
+		}
+	}
+}
+
+func TestRun_EpochsIntersectObservations(t *testing.T) {
+	p := data.Parameters{C: 20, R: 5, X: 0, ServerLoad: 20, L: 3}
+	single, err := Run(p, 100, 7, 0)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	p.Epochs = 4
+	multi, err := Run(p, 100, 7, 0)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	loss := func(ratios []float64) float64 {
+		sum := 0.0
+		for _, ratio := range ratios {
+			sum += math.Abs(math.Log(math.Min(math.Max(ratio, 1e-3), 1e3)))
+		}
+		return sum / float64(len(ratios))
+	}
+
+	for i := range single.Ratios {
+		// the first epoch is the single-epoch trial
+		if math.Abs(multi.EpochRatios[i][0]-single.Ratios[i]) > 1e-9*single.Ratios[i] {
+			t.Fatalf("Trial %d: expected the first epoch to have ratio %f, got %f", i, single.Ratios[i], multi.EpochRatios[i][0])
+		}
+	}
+	if first, last := loss(multi.AfterEpoch(1).Ratios), loss(multi.Ratios); last <= first {
+		t.Fatalf("Expected the mean privacy loss to grow over epochs, got %f after 1 and %f after %d", first, last, p.Epochs)
+	}
+}
+
+// TestRun_PosteriorInvariants checks, under every adversary, topology and traffic pattern, the properties that any
+// correct posterior has: no probability mass is created, the ratio is that of the two probabilities, the per-round and
+// per-epoch ratios end with the final one, only a checkpoint threshold aborts relays, and a trial only depends on its
+// seed.
+func TestRun_PosteriorInvariants(t *testing.T) {
+	for _, p := range []data.Parameters{
+		{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3},
+		{C: 50, R: 10, X: 0.3, ServerLoad: 20, L: 5, T: 2},
+		{C: 30, R: 10, X: 0.5, ServerLoad: 10, L: 4, Adversary: "selective"},
+		{C: 30, R: 10, X: 0.5, ServerLoad: 10, L: 4, Adversary: "delay"},
+		{C: 30, R: 10, X: 0.3, ServerLoad: 10, L: 4, Adversary: "adaptive"},
+		{C: 30, R: 10, X: 0.5, ServerLoad: 10, L: 4, Adversary: "bruise", BruiseThreshold: 1},
+		{C: 40, R: 4, X: 0.25, ServerLoad: 20, L: 3, Adversary: "weighted", RelayWeights: []float64{1, 1, 6, 2}},
+		{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3, Epochs: 3},
+		{C: 30, R: 5, X: 0.2, ServerLoad: 20, L: 3, Pattern: "zipf:1.5"},
+		{C: 30, R: 5, X: 0.2, ServerLoad: 20, L: 3, XClients: 0.2, CorruptedClients: []int{5}},
+		{C: 30, R: 6, X: 0.2, ServerLoad: 20, L: 3, Topology: "stratified"},
+		{C: 30, R: 6, X: 0.2, ServerLoad: 20, L: 3, Topology: "cascade:2"},
+	} {
+		result, err := Run(p, 20, 1, 1)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		parallel, err := Run(p, 20, 1, 4)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		// the batches record how the trials were run, so only the trials are compared
+		if !reflect.DeepEqual(result.Seeds, parallel.Seeds) || !reflect.DeepEqual(result.View, parallel.View) || !reflect.DeepEqual(result.Scenario1, parallel.Scenario1) {
+			t.Fatalf("%s: the results differ between sequential and parallel runs with the same seed", p.Hash())
+		}
+
+		for scenario := 0; scenario < 2; scenario++ {
+			v := result.Scenario(scenario)
+			for i, ratio := range v.Ratios {
+				pr0, pr1 := v.Pr0[i], v.Pr1[i]
+				if pr0 < 0 || pr1 < 0 || pr0+pr1 > 1+1e-9 {
+					t.Fatalf("%s: scenario %d, trial %d: expected at most all of the mass at the receivers, got %f and %f", p.Hash(), scenario, i, pr0, pr1)
+				}
+				if ratio != rounds.Ratio(pr0, pr1) {
+					t.Fatalf("%s: scenario %d, trial %d: expected ratio %f, got %f", p.Hash(), scenario, i, rounds.Ratio(pr0, pr1), ratio)
+				}
+				var last []float64
+				if p.Epochs > 1 {
+					last = v.EpochRatios[i]
+				} else {
+					last = v.RoundRatios[i]
+				}
+				if len(last) == 0 || math.Abs(last[len(last)-1]-ratio) > 1e-9*ratio {
+					t.Fatalf("%s: scenario %d, trial %d: expected the recorded ratios %v to end with %f", p.Hash(), scenario, i, last, ratio)
+				}
+				if p.T == 0 && v.Aborted[i] != 0 {
+					t.Fatalf("%s: scenario %d, trial %d: expected no aborts without a checkpoint threshold, got %d", p.Hash(), scenario, i, v.Aborted[i])
+				}
+			}
+		}
+	}
+}
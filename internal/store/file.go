@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileStore is a ResultStore that needs no database server. Every call to Append writes one JSON-encoded data.Result
+// as a single line and syncs the file before returning, so a crash loses at most the trials being appended.
+type FileStore struct {
+	path string
+	f    *os.File
+	size int64 // length of the file up to the end of the last complete line
+	mu   sync.Mutex
+}
+
+// NewFileStore opens (or creates) the JSON-lines file at path. A partially written last line, left behind by a process
+// that died in the middle of an Append, is discarded.
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to open %s", path)
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, pl.WrapError(err, "failed to read %s", path)
+	}
+	size := int64(bytes.LastIndexByte(content, '\n') + 1)
+	if err = f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, pl.WrapError(err, "failed to truncate %s", path)
+	}
+	if _, err = f.Seek(size, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, pl.WrapError(err, "failed to seek in %s", path)
+	}
+	return &FileStore{
+		path: path,
+		f:    f,
+		size: size,
+	}, nil
+}
+
+func (s *FileStore) Append(_ context.Context, v data.Result) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return pl.WrapError(err, "failed to marshal result for %s", v.P.Hash())
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err = s.f.Write(line); err == nil {
+		err = s.f.Sync()
+	}
+	if err != nil {
+		// roll back to the last complete line, so that a later Append doesn't extend a broken one
+		_ = s.f.Truncate(s.size)
+		_, _ = s.f.Seek(s.size, io.SeekStart)
+		return pl.WrapError(err, "failed to append result for %s to %s", v.P.Hash(), s.path)
+	}
+	s.size += int64(len(line))
+	return nil
+}
+
+func (s *FileStore) Load(_ context.Context) (map[string]data.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := make(collection)
+	reader := bufio.NewReader(io.NewSectionReader(s.f, 0, s.size))
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return c.results(), nil
+		} else if err != nil {
+			return nil, pl.WrapError(err, "failed to read %s", s.path)
+		}
+		var v data.Result
+		if err = json.Unmarshal(line, &v); err != nil {
+			return nil, pl.WrapError(err, "failed to unmarshal line %d of %s", lineNumber, s.path)
+		}
+		if err = c.add(v); err != nil {
+			return nil, pl.WrapError(err, "failed to load line %d of %s", lineNumber, s.path)
+		}
+	}
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/store/db"
+	_ "github.com/lib/pq"
+)
+
+//go:embed sql/schema.sql
+var schema string
+
+// PostgresStore is a ResultStore that keeps one row per trial in a Postgres database. The queries in package db are
+// generated with sqlc from sql/query.sql (run `sqlc generate` from the repository root after changing them).
+type PostgresStore struct {
+	conn    *sql.DB
+	queries *db.Queries
+}
+
+// NewPostgresStore connects to the database at dsn and creates the trials table if it doesn't exist yet.
+func NewPostgresStore(ctx context.Context, dsn string) (*PostgresStore, error) {
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to open database")
+	}
+	if err = conn.PingContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, pl.WrapError(err, "failed to connect to database")
+	}
+	if _, err = conn.ExecContext(ctx, schema); err != nil {
+		_ = conn.Close()
+		return nil, pl.WrapError(err, "failed to create schema")
+	}
+	return &PostgresStore{
+		conn:    conn,
+		queries: db.New(conn),
+	}, nil
+}
+
+// Append inserts one row per trial of v in a single transaction. Every row records the batch its trial belongs to.
+func (s *PostgresStore) Append(ctx context.Context, v data.Result) error {
+	v, err := v.Upgrade()
+	if err != nil {
+		return err
+	}
+	params, err := json.Marshal(v.P)
+	if err != nil {
+		return pl.WrapError(err, "failed to marshal parameters %s", v.P.Hash())
+	}
+	batches := make([]json.RawMessage, 0, len(v.Ratios))
+	for _, batch := range v.Batches {
+		content, err := json.Marshal(batch)
+		if err != nil {
+			return pl.WrapError(err, "failed to marshal batch of %s", v.P.Hash())
+		}
+		for i := 0; i < batch.NumTrials; i++ {
+			batches = append(batches, content)
+		}
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return pl.WrapError(err, "failed to begin transaction")
+	}
+	defer tx.Rollback() // no-op once committed
+
+	queries := s.queries.WithTx(tx)
+	for i := range v.Ratios {
+		if err = queries.InsertTrial(ctx, toRow(v, params, batches, i)); err != nil {
+			return pl.WrapError(err, "failed to insert trial %d of %s", i, v.P.Hash())
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return pl.WrapError(err, "failed to commit trials of %s", v.P.Hash())
+	}
+	return nil
+}
+
+func (s *PostgresStore) Load(ctx context.Context) (map[string]data.Result, error) {
+	rows, err := s.queries.ListTrials(ctx)
+	if err != nil {
+		return nil, pl.WrapError(err, "failed to list trials")
+	}
+
+	c := make(collection)
+	for _, row := range rows {
+		v, err := fromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.add(v); err != nil {
+			return nil, pl.WrapError(err, "failed to load trial %d", row.ID)
+		}
+	}
+	return c.results(), nil
+}
+
+func (s *PostgresStore) Close() error {
+	return s.conn.Close()
+}
+
+// toRow returns the row for trial i of v, where batches[i] is the batch of trial i. The seed and the Scenario 1 columns
+// are left null if v doesn't record them.
+func toRow(v data.Result, params json.RawMessage, batches []json.RawMessage, i int) db.InsertTrialParams {
+	row := db.InsertTrialParams{
+		ParamKey: v.P.Key(),
+		Params:   params,
+		Pr0:      v.Pr0[i],
+		Pr1:      v.Pr1[i],
+		Ratio:    v.Ratios[i],
+		Version:  int32(v.Version),
+		Batch:    json.RawMessage("{}"),
+	}
+	if i < len(batches) {
+		row.Batch = batches[i]
+	}
+	if i < len(v.Aborted) {
+		row.Aborted = int32(v.Aborted[i])
+	}
+	if i < len(v.RoundRatios) {
+		row.RoundRatios = v.RoundRatios[i]
+	}
+	if i < len(v.EpochRatios) {
+		row.EpochRatios = v.EpochRatios[i]
+	}
+	if i < len(v.Seeds) {
+		row.Seed = sql.NullInt64{Int64: v.Seeds[i], Valid: true}
+	}
+	if s1 := v.Scenario1; i < len(s1.Ratios) {
+		row.Pr0S1 = sql.NullFloat64{Float64: s1.Pr0[i], Valid: true}
+		row.Pr1S1 = sql.NullFloat64{Float64: s1.Pr1[i], Valid: true}
+		row.RatioS1 = sql.NullFloat64{Float64: s1.Ratios[i], Valid: true}
+		if i < len(s1.Aborted) {
+			row.AbortedS1 = sql.NullInt32{Int32: int32(s1.Aborted[i]), Valid: true}
+		}
+		if i < len(s1.RoundRatios) {
+			row.RoundRatiosS1 = s1.RoundRatios[i]
+		}
+		if i < len(s1.EpochRatios) {
+			row.EpochRatiosS1 = s1.EpochRatios[i]
+		}
+	}
+	return row
+}
+
+// fromRow returns a data.Result holding the single trial stored in row.
+func fromRow(row db.Trial) (data.Result, error) {
+	v := data.Result{Version: int(row.Version)}
+	if err := json.Unmarshal(row.Params, &v.P); err != nil {
+		return v, pl.WrapError(err, "failed to unmarshal parameters of trial %d", row.ID)
+	}
+	var batch data.Batch
+	if err := json.Unmarshal(row.Batch, &batch); err != nil {
+		return v, pl.WrapError(err, "failed to unmarshal batch of trial %d", row.ID)
+	}
+	if batch.NumTrials > 0 {
+		// the trials of a batch are merged back together by data.Result.Append
+		batch.NumTrials = 1
+		v.Batches = []data.Batch{batch}
+	}
+	v.View = data.View{
+		Pr0:     []float64{row.Pr0},
+		Pr1:     []float64{row.Pr1},
+		Ratios:  []float64{row.Ratio},
+		Aborted: []int{int(row.Aborted)},
+	}
+	if row.RoundRatios != nil {
+		v.RoundRatios = [][]float64{row.RoundRatios}
+	}
+	if row.EpochRatios != nil {
+		v.EpochRatios = [][]float64{row.EpochRatios}
+	}
+	if row.Seed.Valid {
+		v.Seeds = []int64{row.Seed.Int64}
+	}
+	if row.RatioS1.Valid {
+		v.Scenario1 = data.View{
+			Pr0:    []float64{row.Pr0S1.Float64},
+			Pr1:    []float64{row.Pr1S1.Float64},
+			Ratios: []float64{row.RatioS1.Float64},
+		}
+		if row.AbortedS1.Valid {
+			v.Scenario1.Aborted = []int{int(row.AbortedS1.Int32)}
+		}
+		if row.RoundRatiosS1 != nil {
+			v.Scenario1.RoundRatios = [][]float64{row.RoundRatiosS1}
+		}
+		if row.EpochRatiosS1 != nil {
+			v.Scenario1.EpochRatios = [][]float64{row.EpochRatiosS1}
+		}
+	}
+	return v, nil
+}
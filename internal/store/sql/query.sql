@@ -0,0 +1,9 @@
+-- name: InsertTrial :exec
+INSERT INTO trials (param_key, params, seed, pr0, pr1, ratio, aborted, pr0_s1, pr1_s1, ratio_s1, aborted_s1,
+                    round_ratios, round_ratios_s1, epoch_ratios, epoch_ratios_s1, version, batch)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17);
+
+-- name: ListTrials :many
+SELECT *
+FROM trials
+ORDER BY id;
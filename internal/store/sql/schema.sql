@@ -0,0 +1,32 @@
+-- One row per trial. The Scenario 1 columns and the seed are null for trials recorded before both scenarios were
+-- simulated or before seeds were recorded.
+CREATE TABLE IF NOT EXISTS trials
+(
+    id         BIGSERIAL PRIMARY KEY,
+    param_key  TEXT             NOT NULL,
+    params     JSONB            NOT NULL,
+    seed       BIGINT,
+    pr0        DOUBLE PRECISION NOT NULL,
+    pr1        DOUBLE PRECISION NOT NULL,
+    ratio      DOUBLE PRECISION NOT NULL,
+    aborted    INTEGER          NOT NULL DEFAULT 0,
+    pr0_s1     DOUBLE PRECISION,
+    pr1_s1     DOUBLE PRECISION,
+    ratio_s1   DOUBLE PRECISION,
+    aborted_s1 INTEGER,
+    created_at TIMESTAMPTZ      NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS trials_param_key_idx ON trials (param_key, id);
+
+ALTER TABLE trials
+    ADD COLUMN IF NOT EXISTS round_ratios    DOUBLE PRECISION[],
+    ADD COLUMN IF NOT EXISTS round_ratios_s1 DOUBLE PRECISION[],
+    ADD COLUMN IF NOT EXISTS epoch_ratios    DOUBLE PRECISION[],
+    ADD COLUMN IF NOT EXISTS epoch_ratios_s1 DOUBLE PRECISION[];
+
+-- The format version of the result the trial was appended in (see data.SchemaVersion), and the data.Batch of the run
+-- that produced it. Rows appended before results were versioned are version 0 with an empty batch.
+ALTER TABLE trials
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS batch   JSONB   NOT NULL DEFAULT '{}';
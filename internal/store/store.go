@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"strings"
+)
+
+// ResultStore persists the trials collected for every set of parameters, so that no completed trial is lost if the
+// process that collected it dies.
+type ResultStore interface {
+	// Append durably adds the trials of v to those already stored for v.P. Either all of them are stored or none are.
+	Append(ctx context.Context, v data.Result) error
+	// Load returns every stored result, upgraded to data.SchemaVersion and keyed by Parameters.Key, with trials in the
+	// order they were appended.
+	Load(ctx context.Context) (map[string]data.Result, error)
+	Close() error
+}
+
+// Open opens the store at uri: the Postgres database for a postgres:// or postgresql:// URL, or else the JSON-lines
+// file at that path (created if it doesn't exist).
+func Open(ctx context.Context, uri string) (ResultStore, error) {
+	if strings.HasPrefix(uri, "postgres://") || strings.HasPrefix(uri, "postgresql://") {
+		return NewPostgresStore(ctx, uri)
+	}
+	return NewFileStore(uri)
+}
+
+// collection gathers the results read by Load, one per stored line or row, and builds the result of every set of
+// parameters once all of them are read, rather than merging them as they are read, which would copy every trial read
+// so far each time.
+type collection map[string][]data.Result
+
+// add upgrades v and adds it after the results collected for v.P.
+func (c collection) add(v data.Result) error {
+	v, err := v.Upgrade()
+	if err != nil {
+		return err
+	}
+	c[v.P.Key()] = append(c[v.P.Key()], v)
+	return nil
+}
+
+// results returns the trials collected for every set of parameters as a single result, keyed by Parameters.Key.
+func (c collection) results() map[string]data.Result {
+	results := make(map[string]data.Result, len(c))
+	for key, parts := range c {
+		var r data.Result
+		for _, v := range parts {
+			r.AppendTrials(v)
+		}
+		results[key] = r
+	}
+	return results
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func trialResult(p data.Parameters, seed int64, ratio float64) data.Result {
+	return data.Result{
+		P:         p,
+		View:      data.View{Pr0: []float64{ratio}, Pr1: []float64{1}, Ratios: []float64{ratio}, Aborted: []int{0}},
+		Seeds:     []int64{seed},
+		Scenario1: data.View{Pr0: []float64{1}, Pr1: []float64{ratio}, Ratios: []float64{1 / ratio}, Aborted: []int{0}},
+	}
+}
+
+func TestFileStore_AppendAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	ctx := context.Background()
+	p := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = s.Append(ctx, trialResult(p, int64(i), float64(i+1))); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// simulate a crash in the middle of an append
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = f.WriteString(`{"P":{"C":20`); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	_ = f.Close()
+
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer s.Close()
+	if err = s.Append(ctx, trialResult(p, 3, 4)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	results, err := s.Load(ctx)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	v, present := results[p.Key()]
+	if !present {
+		t.Fatalf("Expected a result for %s", p.Hash())
+	}
+	if len(v.Ratios) != 4 || !v.HasBothScenarios() || len(v.Seeds) != 4 {
+		t.Fatalf("Expected 4 trials with both scenarios and seeds, got %+v", v)
+	}
+	for i, seed := range v.Seeds {
+		if seed != int64(i) || v.Ratios[i] != float64(i+1) {
+			t.Fatalf("Trial %d is out of order: seed %d, ratio %f", i, seed, v.Ratios[i])
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package sweep
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// constraint is a boolean expression over the parameters of a point, written in Go syntax, e.g. "L <= R && C > R" or
+// `Adversary != "adaptive" || X > 0`. Parameters are numbers (float64) or strings; expressions may use arithmetic
+// (+ - * / %), comparisons (== and != only between operands of the same type), && || and !, and parentheses.
+type constraint struct {
+	source string
+	expr   ast.Expr
+}
+
+func parseConstraint(source string) (*constraint, error) {
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return nil, pl.WrapError(err, "invalid constraint %q", source)
+	}
+	return &constraint{source: source, expr: expr}, nil
+}
+
+// holds reports whether p satisfies c.
+func (c *constraint) holds(p *data.Parameters) (bool, error) {
+	value, err := evaluate(c.expr, p)
+	if err != nil {
+		return false, pl.WrapError(err, "failed to evaluate constraint %q", c.source)
+	}
+	holds, ok := value.(bool)
+	if !ok {
+		return false, pl.NewError("constraint %q is not a boolean expression", c.source)
+	}
+	return holds, nil
+}
+
+// evaluate returns the value of expr for p: a float64, a string or a bool.
+func evaluate(expr ast.Expr, p *data.Parameters) (interface{}, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return evaluate(e.X, p)
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT, token.FLOAT:
+			return strconv.ParseFloat(e.Value, 64)
+		case token.STRING:
+			return strconv.Unquote(e.Value)
+		}
+	case *ast.Ident:
+		switch e.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		if param, present := findParameter(e.Name); present {
+			return param.get(p), nil
+		}
+		return nil, pl.NewError("unknown parameter %s (expected one of %v)", e.Name, parameterNames())
+	case *ast.UnaryExpr:
+		x, err := evaluate(e.X, p)
+		if err != nil {
+			return nil, err
+		}
+		switch x := x.(type) {
+		case bool:
+			if e.Op == token.NOT {
+				return !x, nil
+			}
+		case float64:
+			switch e.Op {
+			case token.SUB:
+				return -x, nil
+			case token.ADD:
+				return x, nil
+			}
+		}
+	case *ast.BinaryExpr:
+		return evaluateBinary(e, p)
+	}
+	return nil, pl.NewError("unsupported expression %T", expr)
+}
+
+func evaluateBinary(e *ast.BinaryExpr, p *data.Parameters) (interface{}, error) {
+	x, err := evaluate(e.X, p)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || only evaluate their right operand when needed
+	if e.Op == token.LAND || e.Op == token.LOR {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, pl.NewError("operand of %s is not a boolean", e.Op)
+		}
+		if b == (e.Op == token.LOR) {
+			return b, nil
+		}
+		y, err := evaluate(e.Y, p)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok = y.(bool); !ok {
+			return nil, pl.NewError("operand of %s is not a boolean", e.Op)
+		}
+		return b, nil
+	}
+
+	y, err := evaluate(e.Y, p)
+	if err != nil {
+		return nil, err
+	}
+	if e.Op == token.EQL || e.Op == token.NEQ {
+		// a number never equals a string, so comparing them is a mistake in the constraint (e.g. a misspelled value)
+		if reflect.TypeOf(x) != reflect.TypeOf(y) {
+			return nil, pl.NewError("operands of %s have different types (%T and %T)", e.Op, x, y)
+		}
+		return (x == y) == (e.Op == token.EQL), nil
+	}
+
+	a, aIsNumber := x.(float64)
+	b, bIsNumber := y.(float64)
+	if !aIsNumber || !bIsNumber {
+		return nil, pl.NewError("operands of %s are not numbers", e.Op)
+	}
+	switch e.Op {
+	case token.ADD:
+		return a + b, nil
+	case token.SUB:
+		return a - b, nil
+	case token.MUL:
+		return a * b, nil
+	case token.QUO:
+		return a / b, nil
+	case token.REM:
+		return math.Mod(a, b), nil
+	case token.LSS:
+		return a < b, nil
+	case token.LEQ:
+		return a <= b, nil
+	case token.GTR:
+		return a > b, nil
+	case token.GEQ:
+		return a >= b, nil
+	}
+	return nil, pl.NewError("unsupported operator %s", e.Op)
+}
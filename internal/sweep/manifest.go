@@ -0,0 +1,421 @@
+package sweep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultMaxFailures is the number of consecutive failed jobs after which a point is no longer scheduled.
+const DefaultMaxFailures = 3
+
+// saveInterval is how often, at most, the outcomes of trials are saved (see Manifest.Done).
+var saveInterval = 5 * time.Second
+
+// Point is a set of parameters of a sweep along with its progress.
+type Point struct {
+	P             data.Parameters
+	Target        int     // number of trials wanted
+	Completed     int     // number of trials stored so far
+	Failures      int     // number of consecutive jobs that failed (the point is no longer scheduled at MaxFailures)
+	TotalFailures int     `json:",omitempty"` // number of jobs that failed, whether or not a later one succeeded
+	LastError     string  `json:",omitempty"`
+	inFlight      int     // number of trials handed out by Next that are still running
+	width         float64 // width of the confidence interval on the point's measure (see Manifest.Measure)
+	measured      int     // number of trials width was measured on (0 if it wasn't)
+}
+
+// Remaining returns the number of trials that still have to be run (or are running) for p to reach its target.
+func (p *Point) Remaining() int {
+	return utils.Max(p.Target-p.Completed, 0)
+}
+
+// Manifest is the durable state of a parameter sweep. It is saved to disk after every change to the sweep, and every
+// saveInterval as trials complete, so a sweep that is interrupted picks up where it left off when the manifest is
+// loaded again. The trials completed since the last save are not lost: they are in the store, and adding the points
+// again brings their completed counts up to date.
+type Manifest struct {
+	Points      []*Point
+	Paused      bool
+	MaxFailures int
+	Precision   *Precision `json:",omitempty"` // nil runs the target number of trials at every point
+
+	path    string
+	index   map[string]*Point // Parameters.Key -> point
+	resumed chan struct{}     // closed when a paused sweep is resumed
+	rate    rate
+	saved   time.Time // when the manifest was last saved
+	dirty   bool      // whether the manifest changed since then
+	mu      sync.Mutex
+}
+
+// Progress summarizes the state of a sweep.
+type Progress struct {
+	Target    int           // total number of trials wanted
+	Completed int           // number of trials stored so far
+	Precise   int           // number of points whose confidence interval is narrow enough (see Precision)
+	Failures  int           // number of failed jobs, including those of points that later succeeded
+	Paused    bool          // whether the sweep is paused
+	Rate      float64       // trials completed per second since the sweep was (re)started, excluding time spent paused
+	ETA       time.Duration // estimated time until every point reaches its target (0 if the rate is unknown)
+	// With a Precision, points that are precise enough stop at the trials they have, and the others count towards
+	// Target and ETA with their most trials.
+}
+
+// LoadManifest loads the manifest saved at path, or returns an empty manifest that will be saved there if the file
+// doesn't exist yet.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{
+		MaxFailures: DefaultMaxFailures,
+	}
+	fileContent, err := ioutil.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, pl.WrapError(err, "failed to read manifest %s", path)
+	} else if err == nil {
+		if err = json.Unmarshal(fileContent, m); err != nil {
+			return nil, pl.WrapError(err, "failed to unmarshal manifest %s", path)
+		}
+	}
+
+	m.path = path
+	m.index = make(map[string]*Point)
+	for _, point := range m.Points {
+		m.index[point.P.Key()] = point
+	}
+	if m.Paused {
+		m.resumed = make(chan struct{})
+	}
+	m.rate.start(time.Now(), m.Paused)
+	return m, nil
+}
+
+// Add adds p to the sweep with the given target number of trials, of which completed are already stored. If p is
+// already part of the sweep, its target is raised (never lowered) and its completed count brought up to date.
+func (m *Manifest) Add(p data.Parameters, target int, completed int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if point, present := m.index[p.Key()]; present {
+		point.Target = utils.Max(point.Target, target)
+		point.Completed = utils.Max(point.Completed, completed)
+	} else {
+		point = &Point{
+			P:         p,
+			Target:    target,
+			Completed: completed,
+		}
+		m.Points = append(m.Points, point)
+		m.index[p.Key()] = point
+	}
+	return m.save()
+}
+
+// SetPrecision makes the sweep adaptive (see Precision), or runs the target number of trials at every point again if
+// precision is nil.
+func (m *Manifest) SetPrecision(precision *Precision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Precision = nil
+	if precision != nil {
+		p, err := precision.withDefaults()
+		if err != nil {
+			return pl.WrapError(err, "invalid precision")
+		}
+		m.Precision = p
+	}
+	for _, point := range m.Points {
+		point.measured = 0
+	}
+	return m.save()
+}
+
+// Measure records the confidence interval on the measure of v, the trials stored so far for a point of the sweep, so
+// that the point is no longer scheduled once the interval is narrow enough. It does nothing without a Precision, or
+// before the point has its minimum number of trials. The interval is computed without holding up the rest of the
+// sweep, and a measurement on fewer trials than the last one is ignored.
+func (m *Manifest) Measure(v data.Result) error {
+	m.mu.Lock()
+	_, present := m.index[v.P.Key()]
+	precision := m.Precision
+	m.mu.Unlock()
+
+	if !present {
+		return pl.NewError("%s is not part of the sweep", v.P.Hash())
+	}
+	if precision == nil || len(v.Ratios) < precision.MinRuns {
+		return nil
+	}
+	width := precision.width(v)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// the precision may have changed while the interval was computed
+	if point := m.index[v.P.Key()]; m.Precision == precision && len(v.Ratios) >= point.measured {
+		point.width = width
+		point.measured = len(v.Ratios)
+	}
+	return nil
+}
+
+// Next hands out a trial of the point that is furthest from its target (relative to the target), so that all points
+// progress evenly. With a Precision, points first get their minimum number of trials, evenly, and then the point
+// whose confidence interval is the widest gets the next trial, until every interval is narrow enough. It blocks while
+// the sweep is paused, and returns false once no point needs more trials or ctx is done. Every trial handed out must
+// be reported back with Done.
+func (m *Manifest) Next(ctx context.Context) (data.Parameters, bool) {
+	for {
+		m.mu.Lock()
+		if m.Paused {
+			resumed := m.resumed
+			m.mu.Unlock()
+			select {
+			case <-resumed:
+				continue
+			case <-ctx.Done():
+				return data.Parameters{}, false
+			}
+		}
+
+		var next *Point
+		for _, point := range m.Points {
+			if !m.needsTrials(point) {
+				continue
+			}
+			if next == nil || m.before(point, next) {
+				next = point
+			}
+		}
+		if next == nil || ctx.Err() != nil {
+			m.mu.Unlock()
+			return data.Parameters{}, false
+		}
+		next.inFlight++
+		m.mu.Unlock()
+		return next.P, true
+	}
+}
+
+// Done records the outcome of a trial of p handed out by Next. A success resets the point's failures. The manifest is
+// saved if it wasn't for saveInterval; call Flush to save the outcomes recorded since.
+func (m *Manifest) Done(p data.Parameters, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	point, present := m.index[p.Key()]
+	if !present {
+		return pl.NewError("%s is not part of the sweep", p.Hash())
+	}
+	point.inFlight--
+	if err != nil {
+		point.Failures++
+		point.TotalFailures++
+		point.LastError = err.Error()
+	} else {
+		point.Completed++
+		point.Failures = 0
+		point.LastError = ""
+		m.rate.add()
+	}
+	m.dirty = true
+	if time.Since(m.saved) < saveInterval {
+		return nil
+	}
+	return m.save()
+}
+
+// Flush saves the outcomes recorded by Done since the manifest was last saved, if any.
+func (m *Manifest) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+	return m.save()
+}
+
+// Pause stops Next from handing out trials until Resume is called. Trials already handed out still complete.
+func (m *Manifest) Pause() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Paused {
+		return nil
+	}
+	m.Paused = true
+	m.resumed = make(chan struct{})
+	m.rate.pause(time.Now())
+	return m.save()
+}
+
+// Resume lets a paused sweep continue.
+func (m *Manifest) Resume() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.Paused {
+		return nil
+	}
+	m.Paused = false
+	close(m.resumed)
+	m.rate.resume(time.Now())
+	return m.save()
+}
+
+// Progress returns a summary of the sweep.
+func (m *Manifest) Progress() Progress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := Progress{
+		Paused: m.Paused,
+		Rate:   m.rate.perSecond(time.Now()),
+	}
+	remaining := 0
+	for _, point := range m.Points {
+		p.Completed += point.Completed
+		p.Failures += point.TotalFailures
+		if m.precise(point) {
+			p.Precise++
+			p.Target += point.Completed
+			continue
+		}
+		p.Target += point.Target
+		if point.Failures < m.MaxFailures {
+			remaining += point.Remaining()
+		}
+	}
+	if p.Rate > 0 {
+		p.ETA = time.Duration(float64(remaining) / p.Rate * float64(time.Second))
+	}
+	return p
+}
+
+// save writes the manifest to a temporary file and renames it over the previous one, so that a crash never leaves a
+// partially written manifest behind.
+func (m *Manifest) save() error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return pl.WrapError(err, "failed to marshal manifest")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(m.path), filepath.Base(m.path)+".*.tmp")
+	if err != nil {
+		return pl.WrapError(err, "failed to create temporary manifest")
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return pl.WrapError(err, "failed to write manifest")
+	}
+	if err = os.Rename(tmp.Name(), m.path); err != nil {
+		return pl.WrapError(err, "failed to replace manifest %s", m.path)
+	}
+	m.saved, m.dirty = time.Now(), false
+	return nil
+}
+
+// needsTrials reports whether Next should hand out more trials of point.
+func (m *Manifest) needsTrials(point *Point) bool {
+	if point.Failures >= m.MaxFailures || point.Remaining()-point.inFlight <= 0 {
+		return false
+	}
+	if m.Precision == nil || point.Completed+point.inFlight < m.Precision.MinRuns {
+		return true
+	}
+	return projectedWidth(point) > m.Precision.Width
+}
+
+// before reports whether Next should hand out a trial of a before one of b.
+func (m *Manifest) before(a, b *Point) bool {
+	if m.Precision == nil {
+		return progress(a) < progress(b)
+	}
+	// points below their minimum number of trials go first, evenly
+	aStarted := a.Completed+a.inFlight >= m.Precision.MinRuns
+	bStarted := b.Completed+b.inFlight >= m.Precision.MinRuns
+	if aStarted != bStarted {
+		return !aStarted
+	}
+	if !aStarted {
+		return a.Completed+a.inFlight < b.Completed+b.inFlight
+	}
+	aWidth, bWidth := projectedWidth(a), projectedWidth(b)
+	if aWidth == bWidth {
+		return progress(a) < progress(b)
+	}
+	return aWidth > bWidth
+}
+
+// precise reports whether point has its minimum number of trials and a confidence interval that is narrow enough.
+func (m *Manifest) precise(point *Point) bool {
+	return m.Precision != nil && point.Completed >= m.Precision.MinRuns && point.measured > 0 &&
+		point.width <= m.Precision.Width
+}
+
+// projectedWidth returns the width that the confidence interval of p is expected to have once the trials handed out
+// complete: intervals narrow with the square root of the number of trials.
+func projectedWidth(p *Point) float64 {
+	if p.measured == 0 || math.IsNaN(p.width) {
+		return math.Inf(1)
+	}
+	return p.width * math.Sqrt(float64(p.measured)/float64(utils.Max(p.Completed+p.inFlight, p.measured)))
+}
+
+// progress returns the fraction of its target that p has completed (or handed out).
+func progress(p *Point) float64 {
+	if p.Target == 0 {
+		return 1
+	}
+	return float64(p.Completed+p.inFlight) / float64(p.Target)
+}
+
+// rate measures the throughput of a sweep since it was (re)started, excluding the time it spent paused.
+type rate struct {
+	completed int
+	since     time.Time     // when the measurement started
+	paused    time.Duration // total time spent paused since then
+	pausedAt  time.Time     // when the sweep was last paused (zero while running)
+}
+
+func (r *rate) start(now time.Time, paused bool) {
+	r.since = now
+	if paused {
+		r.pausedAt = now
+	}
+}
+
+func (r *rate) add() {
+	r.completed++
+}
+
+func (r *rate) pause(now time.Time) {
+	r.pausedAt = now
+}
+
+func (r *rate) resume(now time.Time) {
+	r.paused += now.Sub(r.pausedAt)
+	r.pausedAt = time.Time{}
+}
+
+func (r *rate) perSecond(now time.Time) float64 {
+	active := now.Sub(r.since) - r.paused
+	if !r.pausedAt.IsZero() {
+		active -= now.Sub(r.pausedAt)
+	}
+	if r.completed == 0 || active <= 0 {
+		return 0
+	}
+	return float64(r.completed) / active.Seconds()
+}
@@ -0,0 +1,218 @@
+package sweep
+
+import (
+	"context"
+	"errors"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifest_ResumesAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sweep.json")
+	p1 := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+	p2 := data.Parameters{C: 20, R: 5, X: 0.4, ServerLoad: 10, L: 3}
+
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = m.Add(p1, 2, 0); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = m.Add(p2, 2, 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// the point furthest from its target goes first
+	p, ok := m.Next(context.Background())
+	if !ok || p.Hash() != p1.Hash() {
+		t.Fatalf("Expected %s, got %s", p1.Hash(), p.Hash())
+	}
+	if err = m.Done(p, nil); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = m.Flush(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// restart
+	m, err = LoadManifest(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if progress := m.Progress(); progress.Completed != 2 || progress.Target != 4 {
+		t.Fatalf("Expected 2 of 4 trials completed, got %+v", progress)
+	}
+
+	for i := 0; i < 2; i++ {
+		p, ok = m.Next(context.Background())
+		if !ok {
+			t.Fatalf("Expected trial %d to be handed out", i)
+		}
+		if err = m.Done(p, nil); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if _, ok = m.Next(context.Background()); ok {
+		t.Fatalf("Expected the sweep to be complete")
+	}
+}
+
+func TestManifest_DoneThrottlesSavesAndResetsFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sweep.json")
+	p := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	m.MaxFailures = 2
+	if err = m.Add(p, 10, 0); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	saved := func() Progress {
+		reloaded, err := LoadManifest(path)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		return reloaded.Progress()
+	}
+
+	// failures only stop a point when they are consecutive
+	for _, failed := range []bool{true, false, true, false} {
+		if _, ok := m.Next(context.Background()); !ok {
+			t.Fatalf("Expected a trial to be handed out")
+		}
+		var jobErr error
+		if failed {
+			jobErr = errors.New("job failed")
+		}
+		if err = m.Done(p, jobErr); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if progress := m.Progress(); progress.Completed != 2 || progress.Failures != 2 || m.Points[0].Failures != 0 || m.Points[0].LastError != "" {
+		t.Fatalf("Expected 2 trials completed and 2 failures, none since the last success, got %+v", progress)
+	}
+
+	// the outcomes are saved once saveInterval has passed since the last save, or on Flush
+	if progress := saved(); progress.Completed != 0 {
+		t.Fatalf("Expected no trials to be saved within saveInterval, got %+v", progress)
+	}
+	if err = m.Flush(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if progress := saved(); progress.Completed != 2 {
+		t.Fatalf("Expected 2 trials to be saved, got %+v", progress)
+	}
+
+	defer func(interval time.Duration) { saveInterval = interval }(saveInterval)
+	saveInterval = 0
+	if _, ok := m.Next(context.Background()); !ok {
+		t.Fatalf("Expected a trial to be handed out")
+	}
+	if err = m.Done(p, nil); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if progress := saved(); progress.Completed != 3 {
+		t.Fatalf("Expected 3 trials to be saved, got %+v", progress)
+	}
+}
+
+func TestManifest_PauseBlocksNext(t *testing.T) {
+	m, err := LoadManifest(filepath.Join(t.TempDir(), "sweep.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	p := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+	if err = m.Add(p, 1, 0); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = m.Pause(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	handedOut := make(chan bool)
+	go func() {
+		_, ok := m.Next(context.Background())
+		handedOut <- ok
+	}()
+
+	select {
+	case <-handedOut:
+		t.Fatalf("Expected Next to block while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err = m.Resume(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if ok := <-handedOut; !ok {
+		t.Fatalf("Expected a trial after resuming")
+	}
+}
+
+func TestManifest_AdaptiveSamplingStopsPrecisePoints(t *testing.T) {
+	m, err := LoadManifest(filepath.Join(t.TempDir(), "sweep.json"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	// the ratios of the trials of each point alternate between these values
+	ratios := map[string][]float64{}
+	constant := data.Parameters{C: 20, R: 5, X: 0.2, ServerLoad: 10, L: 3}
+	narrow := data.Parameters{C: 20, R: 5, X: 0.4, ServerLoad: 10, L: 3}
+	wide := data.Parameters{C: 20, R: 5, X: 0.6, ServerLoad: 10, L: 3}
+	ratios[constant.Key()] = []float64{1, 1}
+	ratios[narrow.Key()] = []float64{0, 2}
+	ratios[wide.Key()] = []float64{0, 10}
+	for _, p := range []data.Parameters{constant, narrow, wide} {
+		if err = m.Add(p, 100, 0); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if err = m.SetPrecision(&Precision{Measure: "ratio", Width: 0.5, MinRuns: 2}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	results := make(map[string]data.Result)
+	handedOut := make([]string, 0)
+	for {
+		p, ok := m.Next(context.Background())
+		if !ok {
+			break
+		}
+		handedOut = append(handedOut, p.Key())
+		v := results[p.Key()]
+		v.P = p
+		v.Ratios = append(v.Ratios, ratios[p.Key()][len(v.Ratios)%2])
+		results[p.Key()] = v
+		if err = m.Done(p, nil); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if err = m.Measure(v); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	// every point first gets its minimum number of trials, then the widest interval goes first
+	if len(handedOut) < 7 || handedOut[6] != wide.Key() {
+		t.Fatalf("Expected %s to get the first trial after the minimum, got %v", wide.Key(), handedOut[6:])
+	}
+	if n := len(results[constant.Key()].Ratios); n != 2 {
+		t.Fatalf("Expected the constant point to stop at its minimum of 2 trials, got %d", n)
+	}
+	if n := len(results[narrow.Key()].Ratios); n <= 2 || n >= 100 {
+		t.Fatalf("Expected the narrow point to stop between its minimum and its most trials, got %d", n)
+	}
+	if width := m.Precision.width(results[narrow.Key()]); width > 0.5 {
+		t.Fatalf("Expected the narrow point to stop once its interval is at most 0.5 wide, got %f", width)
+	}
+	if n := len(results[wide.Key()].Ratios); n != 100 {
+		t.Fatalf("Expected the wide point to get its most trials, got %d", n)
+	}
+	if progress := m.Progress(); progress.Precise != 2 || progress.Target != 2+len(results[narrow.Key()].Ratios)+100 {
+		t.Fatalf("Expected 2 precise points and a target of the trials they have, got %+v", progress)
+	}
+}
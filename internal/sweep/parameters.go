@@ -0,0 +1,106 @@
+package sweep
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"math"
+	"strconv"
+)
+
+// parameter is a field of data.Parameters that a sweep can vary.
+type parameter struct {
+	name string
+	// set parses value and assigns it to the parameter in p.
+	set func(p *data.Parameters, value string) error
+	// get returns the value of the parameter in p as seen by constraints: a float64 for numbers, or a string with
+	// defaults spelled out (e.g. "default" for an unset Adversary).
+	get func(p *data.Parameters) interface{}
+}
+
+// parameters are the parameters a sweep can vary, in the order in which sweeps enumerate them.
+var parameters = []parameter{
+	intParameter("C", 0, func(p *data.Parameters) *int { return &p.C }),
+	intParameter("R", 0, func(p *data.Parameters) *int { return &p.R }),
+	floatParameter("X", func(p *data.Parameters) *float64 { return &p.X }),
+	floatParameter("ServerLoad", func(p *data.Parameters) *float64 { return &p.ServerLoad }),
+	intParameter("L", 0, func(p *data.Parameters) *int { return &p.L }),
+	intParameter("T", 0, func(p *data.Parameters) *int { return &p.T }),
+	intParameter("BruiseThreshold", 0, func(p *data.Parameters) *int { return &p.BruiseThreshold }),
+	stringParameter("Adversary", "default", func(p *data.Parameters) *string { return &p.Adversary }),
+	intParameter("Epochs", 1, func(p *data.Parameters) *int { return &p.Epochs }),
+	stringParameter("Pattern", "permutation", func(p *data.Parameters) *string { return &p.Pattern }),
+	floatParameter("XClients", func(p *data.Parameters) *float64 { return &p.XClients }),
+	stringParameter("Topology", "free", func(p *data.Parameters) *string { return &p.Topology }),
+}
+
+// requiredParameters must be given a value by every grid of a sweep.
+var requiredParameters = []string{"C", "R", "ServerLoad", "L"}
+
+func findParameter(name string) (parameter, bool) {
+	for _, param := range parameters {
+		if param.name == name {
+			return param, true
+		}
+	}
+	return parameter{}, false
+}
+
+func parameterNames() []string {
+	return utils.Map(parameters, func(param parameter) string {
+		return param.name
+	})
+}
+
+func intParameter(name string, defaultValue int, field func(p *data.Parameters) *int) parameter {
+	return parameter{
+		name: name,
+		set: func(p *data.Parameters, value string) error {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || f != math.Trunc(f) {
+				return pl.NewError("%s must be an integer, got %q", name, value)
+			}
+			*field(p) = int(f)
+			return nil
+		},
+		get: func(p *data.Parameters) interface{} {
+			if *field(p) == 0 {
+				return float64(defaultValue)
+			}
+			return float64(*field(p))
+		},
+	}
+}
+
+func floatParameter(name string, field func(p *data.Parameters) *float64) parameter {
+	return parameter{
+		name: name,
+		set: func(p *data.Parameters, value string) error {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return pl.NewError("%s must be a number, got %q", name, value)
+			}
+			*field(p) = f
+			return nil
+		},
+		get: func(p *data.Parameters) interface{} {
+			return *field(p)
+		},
+	}
+}
+
+func stringParameter(name string, defaultValue string, field func(p *data.Parameters) *string) parameter {
+	return parameter{
+		name: name,
+		set: func(p *data.Parameters, value string) error {
+			*field(p) = value
+			return nil
+		},
+		get: func(p *data.Parameters) interface{} {
+			if *field(p) == "" {
+				return defaultValue
+			}
+			return *field(p)
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package sweep
+
+import (
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/privacy"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+	"math"
+)
+
+// Measures are the estimates whose confidence interval Precision can bound.
+var Measures = []string{"epsilon", "ratio"}
+
+// Precision turns a sweep into an adaptive one: instead of running the target number of trials at every point, trials
+// are added to a point until the confidence interval on its estimate is at most Width wide, and the points with the
+// widest intervals go first. The target number of trials of a point becomes the most it is given.
+type Precision struct {
+	// Measure is the estimate to pin down: "epsilon", the smallest ϵ for which (ϵ, Delta)-DP holds (see
+	// privacy.Estimator.EpsilonInterval), or "ratio", the mean ratio reported by the adversary.
+	Measure    string  `yaml:"measure" json:"measure" toml:"measure"`          // "epsilon" by default
+	Width      float64 `yaml:"width" json:"width" toml:"width"`                // widest confidence interval accepted
+	Confidence float64 `yaml:"confidence" json:"confidence" toml:"confidence"` // 0.95 by default
+	Delta      float64 `yaml:"delta" json:"delta" toml:"delta"`                // δ of the ϵ measure, 0.05 by default
+	// MinRuns is the number of trials run at a point before its interval is trusted (20 by default).
+	MinRuns int `yaml:"minRuns" json:"minRuns" toml:"minRuns"`
+}
+
+// withDefaults returns a copy of p with the defaults filled in, or an error if p is invalid.
+func (p Precision) withDefaults() (*Precision, error) {
+	if p.Measure == "" {
+		p.Measure = Measures[0]
+	}
+	if p.Confidence == 0 {
+		p.Confidence = 0.95
+	}
+	if p.Delta == 0 {
+		p.Delta = 0.05
+	}
+	if p.MinRuns == 0 {
+		p.MinRuns = 20
+	}
+	switch {
+	case p.Measure != "epsilon" && p.Measure != "ratio":
+		return nil, pl.NewError("unknown measure %q (expected one of %v)", p.Measure, Measures)
+	case p.Width <= 0:
+		return nil, pl.NewError("width must be positive, got %g", p.Width)
+	case p.Confidence <= 0 || p.Confidence >= 1:
+		return nil, pl.NewError("confidence must be between 0 and 1, got %g", p.Confidence)
+	case p.Delta <= 0 || p.Delta >= 1:
+		return nil, pl.NewError("delta must be between 0 and 1, got %g", p.Delta)
+	case p.MinRuns < 2:
+		return nil, pl.NewError("minRuns must be at least 2, got %d", p.MinRuns)
+	}
+	return &p, nil
+}
+
+// interval returns the confidence interval on the measure of v (infinite with too few trials to bound it).
+func (p *Precision) interval(v data.Result) (lower, upper float64) {
+	if p.Measure == "epsilon" {
+		return privacy.NewEstimator(v, p.Confidence).EpsilonInterval(p.Delta)
+	}
+
+	// Student's t interval on the mean ratio
+	n := len(v.Ratios)
+	if n < 2 {
+		return math.Inf(-1), math.Inf(1)
+	}
+	mean, std := stat.MeanStdDev(v.Ratios, nil)
+	t := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(n - 1)}.Quantile(1 - (1-p.Confidence)/2)
+	halfWidth := t * std / math.Sqrt(float64(n))
+	return mean - halfWidth, mean + halfWidth
+}
+
+// width returns the width of the confidence interval on the measure of v.
+func (p *Precision) width(v data.Result) float64 {
+	lower, upper := p.interval(v)
+	return upper - lower
+}
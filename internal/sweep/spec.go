@@ -0,0 +1,220 @@
+package sweep
+
+import (
+	"fmt"
+	pl "github.com/HannahMarsh/PrettyLogger"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/pkg/utils"
+	"github.com/ilyakaznacheev/cleanenv"
+	"math"
+	"strconv"
+)
+
+// maxAxisValues bounds the number of values of a range, to catch ranges that would never end.
+const maxAxisValues = 10000
+
+// Spec is a declarative parameter sweep, read from a YAML, JSON or TOML file with LoadSpec. For example, in YAML:
+//
+//	runs: 100
+//	parameters:
+//	  C: {values: [1000]}
+//	  ServerLoad: {from: 50000, to: 1000000, factor: 2}
+//	  L: {values: [1, 3, 10, 20]}
+//	constraints:
+//	  - L <= R && C > R
+//	grids:
+//	  - parameters:
+//	      R: {values: [1]}
+//	  - parameters:
+//	      R: {from: 20, to: 100, step: 40}
+//	      X: {values: [0, 0.2]}
+//	    runs: 200
+//	precision:
+//	  width: 0.5
+//
+// Every grid sweeps every combination of the values of its parameters and of the spec's, and keeps the combinations
+// that satisfy every constraint of the spec and of the grid. A spec without grids is a single grid. With a precision,
+// the sweep is adaptive (see Precision), and runs is the most trials a point is given.
+type Spec struct {
+	Runs        int             `yaml:"runs" json:"runs" toml:"runs" env-default:"100"` // trials wanted per point
+	Parameters  map[string]Axis `yaml:"parameters" json:"parameters" toml:"parameters"` // axes shared by every grid
+	Constraints []string        `yaml:"constraints" json:"constraints" toml:"constraints"`
+	Grids       []Grid          `yaml:"grids" json:"grids" toml:"grids"`
+	Precision   *Precision      `yaml:"precision" json:"precision" toml:"precision"`
+}
+
+// Grid is a set of points of a sweep (see Spec). Its parameters replace the spec's parameters of the same name.
+type Grid struct {
+	Runs        int             `yaml:"runs" json:"runs" toml:"runs"` // trials wanted per point (0 keeps the spec's)
+	Parameters  map[string]Axis `yaml:"parameters" json:"parameters" toml:"parameters"`
+	Constraints []string        `yaml:"constraints" json:"constraints" toml:"constraints"`
+}
+
+// Axis is the values a parameter takes in a grid: either the explicit Values, or the range from From to To (both
+// included) in increments of Step or, for a geometric range, in multiples of Factor.
+type Axis struct {
+	Values []interface{} `yaml:"values" json:"values" toml:"values"`
+	From   float64       `yaml:"from" json:"from" toml:"from"`
+	To     float64       `yaml:"to" json:"to" toml:"to"`
+	Step   float64       `yaml:"step" json:"step" toml:"step"`
+	Factor float64       `yaml:"factor" json:"factor" toml:"factor"`
+}
+
+// LoadSpec reads the sweep spec at path, a YAML, JSON or TOML file (see Spec).
+func LoadSpec(path string) (*Spec, error) {
+	var spec Spec
+	if err := cleanenv.ReadConfig(path, &spec); err != nil {
+		return nil, pl.WrapError(err, "failed to read sweep spec %s", path)
+	}
+	return &spec, nil
+}
+
+// Points returns the points of the sweep, each with the number of trials wanted as its Target, in the order in which
+// they are enumerated. A point that belongs to several grids is only returned once, with the largest target.
+func (s *Spec) Points() ([]Point, error) {
+	grids := s.Grids
+	if len(grids) == 0 {
+		grids = []Grid{{}}
+	}
+
+	points := make([]Point, 0)
+	index := make(map[string]int) // Parameters.Key -> index in points
+	for g, grid := range grids {
+		gridPoints, err := s.expand(grid)
+		if err != nil {
+			return nil, pl.WrapError(err, "invalid grid %d", g+1)
+		}
+		for _, point := range gridPoints {
+			if i, present := index[point.P.Key()]; present {
+				points[i].Target = utils.Max(points[i].Target, point.Target)
+			} else {
+				index[point.P.Key()] = len(points)
+				points = append(points, point)
+			}
+		}
+	}
+	return points, nil
+}
+
+// expand returns the points of grid that satisfy its constraints.
+func (s *Spec) expand(grid Grid) ([]Point, error) {
+	axes := make(map[string]Axis)
+	for name, axis := range s.Parameters {
+		axes[name] = axis
+	}
+	for name, axis := range grid.Parameters {
+		axes[name] = axis
+	}
+	runs := grid.Runs
+	if runs == 0 {
+		runs = s.Runs
+	}
+	if runs <= 0 {
+		return nil, pl.NewError("runs must be positive, got %d", runs)
+	}
+
+	for _, name := range requiredParameters {
+		if _, present := axes[name]; !present {
+			return nil, pl.NewError("no values for %s", name)
+		}
+	}
+	type sweptParameter struct {
+		parameter
+		values []string
+	}
+	swept := make([]sweptParameter, 0, len(axes))
+	for name := range axes {
+		if _, present := findParameter(name); !present {
+			return nil, pl.NewError("cannot sweep %q (expected one of %v)", name, parameterNames())
+		}
+	}
+	for _, param := range parameters {
+		if axis, present := axes[param.name]; present {
+			values, err := axis.values()
+			if err != nil {
+				return nil, pl.WrapError(err, "invalid values for %s", param.name)
+			}
+			swept = append(swept, sweptParameter{parameter: param, values: values})
+		}
+	}
+
+	constraints := make([]*constraint, 0)
+	for _, source := range append(utils.Copy(s.Constraints), grid.Constraints...) {
+		c, err := parseConstraint(source)
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+
+	// enumerate every combination of values, like an odometer whose last parameter turns fastest
+	points := make([]Point, 0)
+	digits := make([]int, len(swept))
+	for {
+		p := data.Parameters{}
+		for i, param := range swept {
+			if err := param.set(&p, param.values[digits[i]]); err != nil {
+				return nil, err
+			}
+		}
+		keep := true
+		for _, c := range constraints {
+			holds, err := c.holds(&p)
+			if err != nil {
+				return nil, err
+			}
+			keep = keep && holds
+		}
+		if keep {
+			points = append(points, Point{P: p, Target: runs})
+		}
+
+		i := len(digits) - 1
+		for ; i >= 0; i-- {
+			if digits[i]++; digits[i] < len(swept[i].values) {
+				break
+			}
+			digits[i] = 0
+		}
+		if i < 0 {
+			return points, nil
+		}
+	}
+}
+
+// values returns the values of a, in order.
+func (a Axis) values() ([]string, error) {
+	if len(a.Values) > 0 {
+		if a.Step != 0 || a.Factor != 0 {
+			return nil, pl.NewError("an axis takes either values or a range, not both")
+		}
+		return utils.Map(a.Values, func(value interface{}) string {
+			return fmt.Sprint(value)
+		}), nil
+	}
+
+	next := func(value float64) float64 {
+		return value + a.Step
+	}
+	switch {
+	case a.Step > 0 && a.Factor == 0:
+	case a.Factor > 1 && a.Step == 0 && a.From > 0:
+		next = func(value float64) float64 {
+			return value * a.Factor
+		}
+	default:
+		return nil, pl.NewError("an axis needs values, a positive step, or a factor above 1 and a positive start")
+	}
+
+	values := make([]string, 0)
+	// allow for rounding errors when comparing with the end of the range
+	end := a.To + 1e-9*math.Max(math.Abs(a.To), 1)
+	for value := a.From; value <= end; value = next(value) {
+		if len(values) == maxAxisValues {
+			return nil, pl.NewError("the range from %g to %g has more than %d values", a.From, a.To, maxAxisValues)
+		}
+		// 12 significant digits are enough for parameters and drop the rounding errors of repeated steps
+		values = append(values, strconv.FormatFloat(value, 'g', 12, 64))
+	}
+	return values, nil
+}
@@ -0,0 +1,126 @@
+package sweep
+
+import (
+	"encoding/json"
+	"github.com/HannahMarsh/pi_t-privacy-evaluation/internal/data"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSpec_MatchesExpectedValues(t *testing.T) {
+	spec, err := LoadSpec("../../static/sweep.yaml")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	points, err := spec.Points()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// the points of the UI server's sweep of static/expectedValues.json
+	content, err := os.ReadFile("../../static/expectedValues.json")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var values struct {
+		N, R, ServerLoad, L []int
+		X                   []float64
+	}
+	if err = json.Unmarshal(content, &values); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expected := make(map[string]bool)
+	for _, r := range values.N {
+		for _, c := range values.R {
+			for _, serverLoad := range values.ServerLoad {
+				for _, l := range values.L {
+					for _, x := range values.X {
+						if !((r == 1 && (x != 0.0 || l != 1)) || l > r || c <= r) {
+							p := data.Parameters{C: c, R: r, ServerLoad: float64(serverLoad), L: l, X: x}
+							expected[p.Key()] = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %d points, got %d", len(expected), len(points))
+	}
+	for _, point := range points {
+		if !expected[point.P.Key()] || point.Target != 100 {
+			t.Fatalf("Unexpected point %s with target %d", point.P.Key(), point.Target)
+		}
+	}
+}
+
+func TestSpec_GridsRangesAndConstraints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sweep.toml")
+	content := `
+runs = 10
+constraints = ["L <= R"]
+
+[parameters]
+C = { from = 100, to = 10000, factor = 10 }
+ServerLoad = { values = [20] }
+L = { values = [1, 3] }
+
+[[grids]]
+[grids.parameters]
+R = { values = [1] }
+
+[[grids]]
+runs = 50
+constraints = ['Adversary != "adaptive" || C >= 1000']
+[grids.parameters]
+R = { from = 1, to = 3, step = 2 }
+X = { from = 0.1, to = 0.3, step = 0.1 }
+Adversary = { values = ["default", "adaptive"] }
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	spec, err := LoadSpec(path)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	points, err := spec.Points()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// grid 1: 3 values of C with L = 1 (L = 3 > R)
+	// grid 2: R = 1 (L = 1) or R = 3 (L = 1 or 3), 3 values of X, and either 3 values of C with the default adversary
+	// or 2 with the adaptive one
+	if expected := 3 + 3*3*(3+2); len(points) != expected {
+		t.Fatalf("Expected %d points, got %d", expected, len(points))
+	}
+	targets := make(map[string]int)
+	for _, point := range points {
+		targets[point.P.Key()] = point.Target
+	}
+	p := data.Parameters{C: 100, R: 1, ServerLoad: 20, L: 1}
+	if targets[p.Key()] != 10 {
+		t.Fatalf("Expected %s to keep the target of the first grid, got %d", p.Key(), targets[p.Key()])
+	}
+	p = data.Parameters{C: 10000, R: 3, X: 0.3, ServerLoad: 20, L: 3, Adversary: "adaptive"}
+	if targets[p.Key()] != 50 {
+		t.Fatalf("Expected %s with target 50, got %d", p.Key(), targets[p.Key()])
+	}
+
+	for _, invalid := range []Spec{
+		{Runs: 1, Parameters: map[string]Axis{"C": {Values: []interface{}{10}}}},
+		{Runs: 1, Parameters: map[string]Axis{"C": {Values: []interface{}{10}}, "R": {Values: []interface{}{1}}, "ServerLoad": {From: 1, To: 2}, "L": {Values: []interface{}{1}}}},
+		{Runs: 1, Parameters: map[string]Axis{"C": {Values: []interface{}{10.5}}, "R": {Values: []interface{}{1}}, "ServerLoad": {Values: []interface{}{1}}, "L": {Values: []interface{}{1}}}},
+		{Runs: 1, Parameters: map[string]Axis{"C": {Values: []interface{}{10}}, "R": {Values: []interface{}{1}}, "ServerLoad": {Values: []interface{}{1}}, "L": {Values: []interface{}{1}}}, Constraints: []string{"N > 1"}},
+		{Runs: 1, Parameters: map[string]Axis{"C": {Values: []interface{}{10}}, "R": {Values: []interface{}{1}}, "ServerLoad": {Values: []interface{}{1}}, "L": {Values: []interface{}{1}}}, Constraints: []string{"C + R"}},
+		{Runs: 1, Parameters: map[string]Axis{"C": {Values: []interface{}{10}}, "R": {Values: []interface{}{1}}, "ServerLoad": {Values: []interface{}{1}}, "L": {Values: []interface{}{1}}}, Constraints: []string{`Adversary != 1`}},
+		{Runs: 1, Parameters: map[string]Axis{"C": {Values: []interface{}{10}}, "R": {Values: []interface{}{1}}, "ServerLoad": {Values: []interface{}{1}}, "L": {Values: []interface{}{1}}}, Constraints: []string{`C == "10"`}},
+	} {
+		if _, err = invalid.Points(); err == nil {
+			t.Fatalf("Expected an error for %+v", invalid)
+		}
+	}
+}
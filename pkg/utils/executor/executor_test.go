@@ -145,3 +145,32 @@ func TestIFuture_Map(t *testing.T) {
 		t.Fatalf("Expected 84, got %v", result)
 	}
 }
+
+func TestWorkerPool_StopAfterMoreTasksThanWorkers(t *testing.T) {
+	pool := NewWorkerPoolWithMax(2)
+
+	futures := make([]*Future[int], 10)
+	for i := range futures {
+		index := i
+		futures[i] = SubmitWithError(pool, 0, func() (int, error) {
+			time.Sleep(10 * time.Millisecond)
+			return index, nil
+		})
+	}
+	for i, future := range futures {
+		if result, err := future.Get(); err != nil || result != i {
+			t.Fatalf("Expected %d, got %v (%v)", i, result, err)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		pool.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Stop did not return")
+	}
+}
@@ -26,6 +26,7 @@ func NewTask(fut *IFuture) Task {
 type WorkerPool struct {
 	taskQueue   chan Task
 	workerQueue chan struct{}
+	dispatched  chan struct{} // closed once dispatch has handed out every task
 	wg          sync.WaitGroup
 	allTasks    sync.WaitGroup
 }
@@ -36,6 +37,7 @@ func NewWorkerPool() *WorkerPool {
 	pool := &WorkerPool{
 		taskQueue:   make(chan Task),
 		workerQueue: make(chan struct{}, maxWorkers), // Buffered channel to limit max concurrent workers
+		dispatched:  make(chan struct{}),
 	}
 	go pool.dispatch()
 	return pool
@@ -46,6 +48,7 @@ func NewWorkerPoolWithMax(maxWorkers int) *WorkerPool {
 	pool := &WorkerPool{
 		taskQueue:   make(chan Task),
 		workerQueue: make(chan struct{}, maxWorkers), // Buffered channel to limit max concurrent workers
+		dispatched:  make(chan struct{}),
 	}
 	go pool.dispatch()
 	return pool
@@ -53,21 +56,24 @@ func NewWorkerPoolWithMax(maxWorkers int) *WorkerPool {
 
 // Start initializes the pool to start listening for tasks and dynamically start workers
 func (wp *WorkerPool) dispatch() {
+	defer close(wp.dispatched)
 	for task := range wp.taskQueue {
+		wp.wg.Add(1)
 		select {
 		case wp.workerQueue <- struct{}{}:
-			go wp.worker(task)
+			go wp.worker(task, true)
 		default:
-			go wp.worker(task)
+			go wp.worker(task, false)
 		}
 	}
 }
 
-// worker processes a single task
-func (wp *WorkerPool) worker(task Task) {
-	wp.wg.Add(1)
+// worker processes a single task, releasing its slot in the workerQueue afterwards if it took one
+func (wp *WorkerPool) worker(task Task, hasSlot bool) {
 	defer wp.wg.Done()
-	defer func() { <-wp.workerQueue }()
+	if hasSlot {
+		defer func() { <-wp.workerQueue }()
+	}
 	task.fut.runInThisThread()
 	wp.allTasks.Done()
 }
@@ -115,6 +121,7 @@ func (wp *WorkerPool) submitFuture(fut *IFuture) {
 // Stop gracefully shuts down the worker pool by closing the task queue and waiting for workers to finish
 func (wp *WorkerPool) Stop() {
 	close(wp.taskQueue)
+	<-wp.dispatched
 	wp.wg.Wait()
 }
 
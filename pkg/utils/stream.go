@@ -269,6 +269,21 @@ func GetShuffledCopy[T any](items []T) []T {
 	return result
 }
 
+// ShuffleFrom is like Shuffle but draws from r instead of the global source.
+func ShuffleFrom[T any](r Rand, items []T) {
+	for i := len(items) - 1; i > 0; i-- {
+		j := r.Intn(i + 1)
+		items[i], items[j] = items[j], items[i]
+	}
+}
+
+// GetShuffledCopyFrom is like GetShuffledCopy but draws from r instead of the global source.
+func GetShuffledCopyFrom[T any](r Rand, items []T) []T {
+	result := Copy(items)
+	ShuffleFrom(r, result)
+	return result
+}
+
 func GetKeys[K comparable, V any](m map[K]V) []K {
 	keys := make([]K, 0, len(m))
 	for k := range m {
@@ -112,6 +112,13 @@ func DropFromRight[T any](elements []T, n int) []T {
 
 //var r = rng.New(rng.NewSource(time.Now().UnixNano()))
 
+// Rand is a source of random draws. *rand.Rand satisfies it, but any source of uniform integers can be used (for
+// instance, one that enumerates every possible sequence of draws).
+type Rand interface {
+	// Intn returns a uniformly distributed integer in [0, n).
+	Intn(n int) int
+}
+
 func RandomElement[T any](elements []T) (element T) {
 	index := rng.Intn(len(elements))
 	el := elements[index]
@@ -121,6 +128,31 @@ func RandomElement[T any](elements []T) (element T) {
 	return el
 }
 
+// RandomElementFrom is like RandomElement but draws from r instead of the global source.
+func RandomElementFrom[T any](r Rand, elements []T) (element T) {
+	return elements[r.Intn(len(elements))]
+}
+
+// weightResolution is the number of equally likely values RandomWeightedIndexFrom draws from.
+const weightResolution = 1 << 30
+
+// RandomWeightedIndexFrom returns an index i of weights with probability proportional to weights[i], drawn from r.
+func RandomWeightedIndexFrom(r Rand, weights []float64) int {
+	u := (float64(r.Intn(weightResolution)) + 0.5) / weightResolution * Sum(weights)
+	last := len(weights) - 1
+	for i, weight := range weights {
+		if u < weight {
+			return i
+		}
+		u -= weight
+		if weight > 0 {
+			last = i
+		}
+	}
+	// only reached through rounding error, which must not select an element of weight 0
+	return last
+}
+
 func Min[T constraints.Ordered](a, b T) T {
 	if a < b {
 		return a
@@ -179,6 +211,16 @@ func RandomSubset[T any](array []T, size int) []T {
 	return elements[:size]
 }
 
+// RandomSubsetFrom is like RandomSubset but draws from r instead of the global source.
+func RandomSubsetFrom[T any](r Rand, array []T, size int) []T {
+	elements := Copy(array)
+	if size >= len(elements) {
+		return elements
+	}
+	ShuffleFrom(r, elements)
+	return elements[:size]
+}
+
 func ContainsElement[T comparable](elements []T, element T) bool {
 	for _, e := range elements {
 		if e == element {